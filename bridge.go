@@ -5,11 +5,14 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 // BridgeSubscriber forwards GameEvents to the Bridge's event channel.
 type BridgeSubscriber struct {
 	events chan<- GameEvent
+	tel    *Telemetry
 }
 
 func (s *BridgeSubscriber) OnLogEvent(event GameEvent) {
@@ -17,22 +20,50 @@ func (s *BridgeSubscriber) OnLogEvent(event GameEvent) {
 	case s.events <- event:
 	default:
 		// Drop event if channel is full (avoid blocking log tailer)
+		s.tel.EventDropped(event.Source, "bridge", "queue_full")
 	}
 }
 
 // Bridge fans out GameEvents to all channels and handles inbound messages.
 type Bridge struct {
-	rcon     *RCONPool
-	channels []Channel
-	events   chan GameEvent
+	rcon      *RCONPool
+	companion *Companion
+	channels  []Channel
+	events    chan GameEvent
+	richText  atomic.Pointer[RichTextTranslator]
+	sanitizer atomic.Pointer[InboundSanitizer]
+	limiter   *InboundLimiter
+	notify    bool
+	linker    *AccountLinker
+	tel       *Telemetry
 }
 
-func NewBridge(pool *RCONPool, channels []Channel) *Bridge {
-	return &Bridge{
-		rcon:     pool,
-		channels: channels,
-		events:   make(chan GameEvent, 100),
+func NewBridge(pool *RCONPool, companion *Companion, channels []Channel, richText *RichTextTranslator, sanitizer *InboundSanitizer, limiter *InboundLimiter, notify bool, linker *AccountLinker, tel *Telemetry) *Bridge {
+	b := &Bridge{
+		rcon:      pool,
+		companion: companion,
+		channels:  channels,
+		events:    make(chan GameEvent, 100),
+		limiter:   limiter,
+		notify:    notify,
+		linker:    linker,
+		tel:       tel,
 	}
+	b.richText.Store(richText)
+	b.sanitizer.Store(sanitizer)
+	return b
+}
+
+// SetTextConfig replaces the rich text translation and the inbound
+// sanitizer, e.g. after a config reload.
+func (b *Bridge) SetTextConfig(richText RichTextConfig, inbound InboundConfig) {
+	b.richText.Store(NewRichTextTranslator(richText))
+	b.sanitizer.Store(NewInboundSanitizer(inbound))
+}
+
+// QueueDepth returns the number of events waiting to be sent.
+func (b *Bridge) QueueDepth() int {
+	return len(b.events)
 }
 
 // Events returns the event channel for subscribers to write to.
@@ -42,46 +73,183 @@ func (b *Bridge) Events() chan<- GameEvent {
 
 // FanOutEvents reads events and sends them to all channels.
 func (b *Bridge) FanOutEvents(ctx context.Context) {
+	rconCtx := WithRCONPriority(ctx, PriorityChat)
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case event := <-b.events:
-			for _, ch := range b.channels {
-				if err := ch.Send(ctx, event); err != nil {
-					log.Printf("send to %s: %v", ch.Name(), err)
-				}
-			}
+			b.dispatch(ctx, rconCtx, event)
+		}
+	}
+}
+
+func (b *Bridge) dispatch(ctx, rconCtx context.Context, event GameEvent) {
+	switch event.Type {
+	case "link_request":
+		b.handleLinkRequest(rconCtx, event.Player)
+		return
+	case "discord_online":
+		b.handleOnlineRequest(ctx, rconCtx, event.Player)
+		return
+	}
+	event = b.richText.Load().TranslateEvent(event)
+	if link, ok := b.linker.DiscordFor(event.Player); ok && event.Player != "" {
+		// TranslateEvent copied Extra, so it is safe to modify here.
+		if event.Extra == nil {
+			event.Extra = make(map[string]string)
+		}
+		event.Extra["discord_id"] = link.DiscordID
+	}
+	for _, ch := range b.channels {
+		if err := ch.Send(ctx, event); err != nil {
+			log.Printf("send to %s: %v", ch.Name(), err)
+			b.tel.EventDropped(event.Source, ch.Name(), "send_error")
 		}
 	}
 }
 
 // HandleInbound reads messages from a channel and sends them to Factorio.
 func (b *Bridge) HandleInbound(ctx context.Context, ch Channel) {
+	rconCtx := WithRCONPriority(ctx, PriorityChat)
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case msg := <-ch.Messages():
-			b.sendToFactorio(msg)
+			b.relay(ctx, rconCtx, ch, msg)
+		}
+	}
+}
+
+func (b *Bridge) relay(ctx, rconCtx context.Context, ch Channel, msg InboundMessage) {
+	if reason, notify := b.limiter.Check(ctx, msg); reason != "" {
+		log.Printf("dropped %s message from %s (%s): %s", msg.Source, msg.Author, msg.AuthorID, reason)
+		if n, ok := ch.(Notifier); ok && notify && b.notify {
+			if err := n.NotifyDropped(ctx, msg, reason); err != nil {
+				log.Printf("notify %s: %v", ch.Name(), err)
+			}
+		}
+		return
+	}
+	if err := b.sendToFactorio(rconCtx, msg); err != nil {
+		log.Printf("rcon send to factorio: %v", err)
+	}
+}
+
+// Drain delivers the events and inbound messages still queued once
+// FanOutEvents and HandleInbound have stopped, until the queues are empty or
+// ctx is done. Events left over are counted as dropped.
+func (b *Bridge) Drain(ctx context.Context) {
+	rconCtx := WithRCONPriority(ctx, PriorityChat)
+	for ctx.Err() == nil {
+		busy := false
+		select {
+		case event := <-b.events:
+			b.dispatch(ctx, rconCtx, event)
+			busy = true
+		default:
 		}
+		for _, ch := range b.channels {
+			select {
+			case msg := <-ch.Messages():
+				b.relay(ctx, rconCtx, ch, msg)
+				busy = true
+			default:
+			}
+		}
+		if !busy {
+			return
+		}
+	}
+
+	lost := 0
+	for len(b.events) > 0 {
+		event := <-b.events
+		b.tel.EventDropped(event.Source, "bridge", "shutdown")
+		lost++
+	}
+	for _, ch := range b.channels {
+		lost += len(ch.Messages())
 	}
+	log.Printf("shutdown deadline reached, %d queued events and messages not delivered", lost)
 }
 
-func (b *Bridge) sendToFactorio(msg InboundMessage) {
-	safe := msg.Content
-	safe = strings.ReplaceAll(safe, `\`, `\\`)
-	safe = strings.ReplaceAll(safe, `"`, `\"`)
-	safe = strings.ReplaceAll(safe, "\n", " ")
+// Goodbye posts text to every channel, e.g. to say the exporter is going
+// offline.
+func (b *Bridge) Goodbye(ctx context.Context, text string) {
+	event := GameEvent{Type: "exporter_offline", Message: text, Time: time.Now()}
+	for _, ch := range b.channels {
+		if err := ch.Send(ctx, event); err != nil {
+			log.Printf("goodbye to %s: %v", ch.Name(), err)
+		}
+	}
+}
 
-	if len(safe) > 200 {
-		safe = safe[:200] + "..."
+// sendToFactorio prints msg in game chat. Messages that are empty after
+// sanitizing are skipped.
+func (b *Bridge) sendToFactorio(ctx context.Context, msg InboundMessage) error {
+	if player, ok := b.linker.PlayerFor(msg.AuthorID); ok {
+		msg.Author = fmt.Sprintf("%s (%s: @%s)", player, msg.Source, msg.Author)
 	}
+	line, ok := b.sanitizer.Load().Line(msg)
+	if !ok {
+		return nil
+	}
+	ctx = WithRCONKind(ctx, "print")
+	cmd := b.companion.Command(ctx, "print", line, "game.print("+luaString(line)+")")
 
-	cmd := fmt.Sprintf(`/sc game.print("[color=purple][%s][/color] %s: %s")`,
-		msg.Source, msg.Author, safe)
+	_, err := b.rcon.Execute(ctx, cmd)
+	return err
+}
 
-	if _, err := b.rcon.Execute(cmd); err != nil {
-		log.Printf("rcon send to factorio: %v", err)
+// whisper prints a message to a single player.
+func (b *Bridge) whisper(ctx context.Context, player, text string) {
+	lua := fmt.Sprintf("local p=game.get_player(%s) if p then p.print(%s) end", luaString(player), luaString(text))
+	ctx = WithRCONKind(ctx, "whisper")
+	cmd := b.companion.Command(ctx, "whisper", player+" "+text, lua)
+	if _, err := b.rcon.Execute(ctx, cmd); err != nil {
+		log.Printf("rcon whisper to %s: %v", player, err)
+	}
+}
+
+// handleLinkRequest answers /link-discord with a one-time code for the player.
+func (b *Bridge) handleLinkRequest(ctx context.Context, player string) {
+	if !b.linker.Enabled() {
+		b.whisper(ctx, player, "Account linking is disabled on this server.")
+		return
+	}
+	code, err := b.linker.NewCode(player)
+	if err != nil {
+		log.Printf("link code for %s: %v", player, err)
+		return
+	}
+	b.whisper(ctx, player, fmt.Sprintf("Run /link %s in Discord within %s to link your account.", code, b.linker.ttl))
+}
+
+// handleOnlineRequest answers /discord-online with who is around on each channel.
+func (b *Bridge) handleOnlineRequest(ctx, rconCtx context.Context, player string) {
+	var parts []string
+	for _, ch := range b.channels {
+		lister, ok := ch.(OnlineLister)
+		if !ok {
+			continue
+		}
+		groups, err := lister.Online(ctx)
+		if err != nil {
+			log.Printf("online list from %s: %v", ch.Name(), err)
+			continue
+		}
+		for _, g := range groups {
+			users := "nobody"
+			if len(g.Users) > 0 {
+				users = strings.Join(g.Users, ", ")
+			}
+			parts = append(parts, fmt.Sprintf("%s %s: %s", ch.Name(), g.Name, users))
+		}
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "No chat channels are connected.")
 	}
+	b.whisper(rconCtx, player, b.sanitizer.Load().plain(strings.Join(parts, " | ")))
 }
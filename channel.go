@@ -10,3 +10,21 @@ type Channel interface {
 	Start(ctx context.Context) error
 	Close() error
 }
+
+// Notifier is optionally implemented by channels that can tell an author
+// their message was dropped (e.g. rate limited).
+type Notifier interface {
+	NotifyDropped(ctx context.Context, msg InboundMessage, reason string) error
+}
+
+// OnlineLister is optionally implemented by channels that can tell players
+// in game who is around on the other side (e.g. /discord-online).
+type OnlineLister interface {
+	Online(ctx context.Context) ([]OnlineGroup, error)
+}
+
+// OnlineGroup is a named set of online users, e.g. "voice" or "chat".
+type OnlineGroup struct {
+	Name  string
+	Users []string
+}
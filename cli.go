@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel/metric/noop"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+const cliUsage = `usage: factorio-exporter [command]
+
+Without a command, runs the exporter. Commands use the same config file and
+environment as the exporter:
+
+  schema                  print the event JSON Schema
+  check-config [path]     validate the config and print it, secrets redacted
+  rcon exec "<cmd>"       run an RCON command and print the response
+  collect [--once]        print statistics as JSON, every metrics.interval
+  events tail --drain     register event handlers and print polled events as
+                          JSON; this takes them from the queue, so a running
+                          exporter no longer sees them
+  send [--as NAME] "<msg>"
+                          print a chat message in game
+  lua register            (re)register the Lua event handlers and commands
+`
+
+// runCommand runs an operator subcommand and exits non-zero on failure.
+func runCommand(args []string) {
+	switch cmd := strings.Join(args[:min(len(args), 2)], " "); {
+	case args[0] == "schema":
+		// Print the event JSON Schema for downstream consumers.
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(eventJSONSchema()); err != nil {
+			log.Fatalf("schema: %v", err)
+		}
+	case args[0] == "check-config":
+		checkConfig(args[1:])
+	case cmd == "rcon exec":
+		rconExec(args[2:])
+	case args[0] == "collect":
+		collectStats(args[1:])
+	case cmd == "events tail":
+		tailEvents(args[2:])
+	case args[0] == "send":
+		sendMessage(args[1:])
+	case cmd == "lua register":
+		registerLua()
+	case args[0] == "help" || args[0] == "-h" || args[0] == "--help":
+		fmt.Print(cliUsage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", strings.Join(args, " "), cliUsage)
+		os.Exit(2)
+	}
+}
+
+// checkConfig validates a config file (default $CONFIG_PATH) together with
+// the environment and prints the effective config with secrets redacted. It
+// exits with status 1 on errors, so CI can run it before a rollout.
+func checkConfig(args []string) {
+	path := configPath()
+	if len(args) > 0 {
+		path = args[0]
+	}
+	// The exporter runs without a config file, but a check of one that
+	// isn't there is a mistake.
+	if _, err := os.Stat(path); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	cfg, err := readConfig(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid config:\n%v\n", err)
+		os.Exit(1)
+	}
+	out, err := cfg.redactedYAML()
+	if err != nil {
+		log.Fatalf("render config: %v", err)
+	}
+	fmt.Printf("# effective config from %s and the environment (secrets redacted)\n%s", path, out)
+	if cfg.RCON.Password == "" {
+		fmt.Fprintln(os.Stderr, "warning: RCON_PASSWORD (or RCON_PASSWORD_FILE) is not set; the exporter won't start without it")
+	}
+}
+
+// cliEnv is what the RCON subcommands share. Self-telemetry is recorded but
+// not exported.
+type cliEnv struct {
+	cfg       Config
+	pool      *RCONPool
+	companion *Companion
+	tel       *Telemetry
+}
+
+func newCLIEnv() *cliEnv {
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	tel, err := NewTelemetry(noop.NewMeterProvider().Meter(""))
+	if err != nil {
+		log.Fatalf("telemetry: %v", err)
+	}
+	pool := NewRCONPool(cfg.RCON, tel)
+	return &cliEnv{cfg: cfg, pool: pool, companion: NewCompanion(pool, cfg.RCON.Mode), tel: tel}
+}
+
+// cliContext is cancelled on Ctrl-C and labels RCON commands as "cli".
+func cliContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	return WithRCONKind(ctx, "cli"), cancel
+}
+
+func rconExec(args []string) {
+	if len(args) != 1 {
+		log.Fatal(`usage: factorio-exporter rcon exec "<cmd>"`)
+	}
+	env := newCLIEnv()
+	defer env.pool.Close()
+	ctx, cancel := cliContext()
+	defer cancel()
+
+	resp, err := env.pool.Execute(ctx, args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(resp)
+	if resp != "" && !strings.HasSuffix(resp, "\n") {
+		fmt.Println()
+	}
+}
+
+func collectStats(args []string) {
+	fs := flag.NewFlagSet("collect", flag.ExitOnError)
+	once := fs.Bool("once", false, "collect once and exit")
+	fs.Parse(args)
+
+	env := newCLIEnv()
+	defer env.pool.Close()
+	ctx, cancel := cliContext()
+	defer cancel()
+	ctx = WithRCONPriority(ctx, PriorityMetrics)
+
+	collector, err := NewCollector(env.pool, env.companion, mustReadFile("/lua/collect_summary.lua"),
+		mustReadFile("/lua/collect_page.lua"), env.cfg.Metrics.PageSize, sdkmetric.NewMeterProvider(), env.tel)
+	if err != nil {
+		log.Fatalf("collector: %v", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	for {
+		stats, err := collector.Collect(ctx)
+		if stats != nil {
+			enc.Encode(stats)
+		}
+		if *once {
+			if err != nil {
+				log.Fatalf("collect: %v", err)
+			}
+			return
+		}
+		if err != nil {
+			log.Printf("collect: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(env.cfg.Metrics.Interval):
+		}
+	}
+}
+
+// jsonSubscriber prints events as JSON lines.
+type jsonSubscriber struct {
+	enc *json.Encoder
+}
+
+func (s *jsonSubscriber) OnLogEvent(event GameEvent) {
+	if err := s.enc.Encode(event); err != nil {
+		log.Printf("print event: %v", err)
+	}
+}
+
+func tailEvents(args []string) {
+	fs := flag.NewFlagSet("events tail", flag.ExitOnError)
+	drain := fs.Bool("drain", false, "take events from the in-game queue")
+	fs.Parse(args)
+	if !*drain {
+		// Polling removes events from the queue; there is no way to peek.
+		fmt.Fprintln(os.Stderr, "events tail takes events from the in-game queue, so a running exporter")
+		fmt.Fprintln(os.Stderr, "misses them (no Discord, Loki or OTLP output). Pass --drain to do it anyway.")
+		os.Exit(2)
+	}
+	fmt.Fprintln(os.Stderr, "warning: draining the event queue; a running exporter won't see these events")
+
+	env := newCLIEnv()
+	defer env.pool.Close()
+	ctx, cancel := cliContext()
+	defer cancel()
+
+	// Same stamping and deduplication as the exporter's own output.
+	pipeline := NewEventPipeline(env.cfg.Factorio.ServerName, NewCorrelator(env.cfg.Events.Dedup), env.tel)
+	pipeline.Subscribe(&jsonSubscriber{enc: json.NewEncoder(os.Stdout)})
+	poller := NewEventPoller(env.pool, env.companion, loadRegisterScripts(),
+		mustReadFile("/lua/poll_events.lua"), env.cfg.Events.PollInterval, env.tel)
+	poller.Subscribe(pipeline)
+	poller.Run(ctx)
+}
+
+func sendMessage(args []string) {
+	fs := flag.NewFlagSet("send", flag.ExitOnError)
+	as := fs.String("as", "operator", "author shown in game")
+	fs.Parse(args)
+	text := strings.Join(fs.Args(), " ")
+	if strings.TrimSpace(text) == "" {
+		log.Fatal(`usage: factorio-exporter send [--as NAME] "<msg>"`)
+	}
+
+	env := newCLIEnv()
+	defer env.pool.Close()
+	ctx, cancel := cliContext()
+	defer cancel()
+
+	linker, _ := NewAccountLinker(LinkingConfig{})
+	bridge := NewBridge(env.pool, env.companion, nil, nil, NewInboundSanitizer(env.cfg.Inbound), nil, false, linker, env.tel)
+	err := bridge.sendToFactorio(WithRCONPriority(ctx, PriorityChat), InboundMessage{
+		Source:  "CLI",
+		Author:  *as,
+		Content: text,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func registerLua() {
+	env := newCLIEnv()
+	defer env.pool.Close()
+	ctx, cancel := cliContext()
+	defer cancel()
+
+	if env.companion.Available(ctx) {
+		fmt.Println("companion mod installed; it registers its own handlers")
+		return
+	}
+	poller := NewEventPoller(env.pool, env.companion, loadRegisterScripts(), "", env.cfg.Events.PollInterval, env.tel)
+	if err := poller.executeScripts(ctx); err != nil {
+		log.Fatalf("register: %v", err)
+	}
+	fmt.Println("event handlers and commands registered")
+}
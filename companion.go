@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ModeAuto      = "auto"
+	ModeSC        = "sc"
+	ModeCompanion = "companion"
+
+	companionProbeInterval = 60 * time.Second
+	companionMinVersion    = "0.2.0"
+)
+
+// Companion tracks whether the companion mod (mod/factorio-exporter) is
+// installed on the server. Its commands are registered with
+// commands.add_command, so using them instead of /sc keeps achievements
+// enabled and needs no console command permission.
+type Companion struct {
+	rcon *RCONPool
+	mode string
+
+	mu        sync.Mutex
+	available bool
+	version   string
+	checkedAt time.Time
+	probing   bool // a /fe-version probe is running
+}
+
+func NewCompanion(pool *RCONPool, mode string) *Companion {
+	return &Companion{rcon: pool, mode: mode}
+}
+
+// Available reports whether companion commands should be used. In auto mode
+// the server is probed with /fe-version, and the result is cached for a
+// minute. Only one caller probes at a time; the others get the cached answer
+// meanwhile. Mod versions older than companionMinVersion are ignored.
+func (c *Companion) Available(ctx context.Context) bool {
+	switch c.mode {
+	case ModeSC:
+		return false
+	case ModeCompanion:
+		return true
+	}
+
+	c.mu.Lock()
+	if c.probing || (!c.checkedAt.IsZero() && time.Since(c.checkedAt) < companionProbeInterval) {
+		defer c.mu.Unlock()
+		return c.available
+	}
+	c.probing = true
+	c.mu.Unlock()
+
+	resp, err := c.rcon.Execute(WithRCONKind(ctx, "probe"), "/fe-version")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.probing = false
+	if err != nil {
+		// Keep the previous answer; RCON itself is down.
+		return c.available
+	}
+	version, ok := strings.CutPrefix(strings.TrimSpace(resp), "factorio-exporter ")
+	if !ok {
+		version = ""
+	}
+	available := ok && (version == "scenario" || compareVersions(version, companionMinVersion) >= 0)
+	if available != c.available || version != c.version || c.checkedAt.IsZero() {
+		switch {
+		case available:
+			log.Printf("companion mod %s detected, using /fe-* commands", version)
+		case ok:
+			log.Printf("companion mod %s is older than %s, falling back to Lua injection", version, companionMinVersion)
+		default:
+			log.Println("companion mod not found, falling back to Lua injection")
+		}
+	}
+	c.available = available
+	c.version = version
+	c.checkedAt = time.Now()
+	return c.available
+}
+
+// Version returns the last detected companion mod version, or "" if none.
+func (c *Companion) Version() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.version
+}
+
+// Reset forces the next Available call to probe again, e.g. after a
+// companion command returned something unexpected.
+func (c *Companion) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checkedAt = time.Time{}
+}
+
+// Command returns the RCON command for an operation: /fe-<name> with args
+// when the companion is available, otherwise /sc with the Lua fallback.
+func (c *Companion) Command(ctx context.Context, name, args, lua string) string {
+	if c.Available(ctx) {
+		if args == "" {
+			return "/fe-" + name
+		}
+		return "/fe-" + name + " " + args
+	}
+	return "/sc " + lua
+}
+
+// compareVersions compares dotted numeric versions like "0.1.0" and "0.10.2".
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -1,8 +1,14 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"reflect"
+	"slices"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -16,17 +22,43 @@ type Config struct {
 	Events   EventsConfig   `yaml:"events"`
 	Discord  DiscordConfig  `yaml:"discord"`
 	Loki     LokiConfig     `yaml:"loki"`
+	RichText RichTextConfig `yaml:"rich_text"`
+	Inbound  InboundConfig  `yaml:"inbound"`
+	Linking  LinkingConfig  `yaml:"linking"`
+	Health   HealthConfig   `yaml:"health"`
+	Shutdown ShutdownConfig `yaml:"shutdown"`
 }
 
 type RCONConfig struct {
-	Host     string `yaml:"host"`
-	Port     string `yaml:"port"`
-	Password string `yaml:"-"` // from env only
+	Host     string        `yaml:"host"`
+	Port     string        `yaml:"port"`
+	Password string        `yaml:"-"`    // from env only
+	Mode     string        `yaml:"mode"` // "auto", "sc" or "companion" (see mod/factorio-exporter)
+	PoolSize int           `yaml:"pool_size"`
+	Timeout  time.Duration `yaml:"timeout"` // per command, including the wait for a free connection
 }
 
 type FactorioConfig struct {
-	Namespace string `yaml:"namespace"`
-	PodLabel  string `yaml:"pod_label"`
+	LogSource  string `yaml:"log_source"`  // "kubernetes", "file", "docker" or "journald"
+	ServerName string `yaml:"server_name"` // stamped on every event; tells servers apart in shared Loki/Discord
+
+	// kubernetes
+	Namespace  string `yaml:"namespace"`
+	PodLabel   string `yaml:"pod_label"`
+	Kubeconfig string `yaml:"kubeconfig"` // empty = in-cluster service account (or $KUBECONFIG outside a cluster)
+
+	// file
+	LogFile string `yaml:"log_file"`
+
+	// docker
+	DockerSocket    string `yaml:"docker_socket"`
+	DockerContainer string `yaml:"docker_container"`
+
+	// journald
+	JournaldUnit string `yaml:"journald_unit"`
+
+	// Log line patterns; replace built-ins by type or add new event types
+	LogPatterns []LogPatternConfig `yaml:"log_patterns"`
 }
 
 type OTelConfig struct {
@@ -37,35 +69,116 @@ type OTelConfig struct {
 type MetricsConfig struct {
 	Enabled  bool          `yaml:"enabled"`
 	Interval time.Duration `yaml:"interval"`
+	PageSize int           `yaml:"page_size"` // entries per RCON response when paging statistics
 }
 
 type EventsConfig struct {
 	Enabled      bool          `yaml:"enabled"`
 	PollInterval time.Duration `yaml:"poll_interval"`
-	Types        []string      `yaml:"types"` // list of event types, or ["all"]
+	Types        EventList     `yaml:"types"`
+	Dedup        DedupConfig   `yaml:"dedup"`
+}
+
+// EventList is a list of event types, or "all". A plain "all" is accepted
+// in place of a list.
+type EventList []string
+
+func (l *EventList) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		*l = EventList{n.Value}
+		return nil
+	}
+	var types []string
+	if err := n.Decode(&types); err != nil {
+		return err
+	}
+	*l = types
+	return nil
+}
+
+// Allows reports whether the list contains eventType or "all".
+func (l EventList) Allows(eventType string) bool {
+	for _, e := range l {
+		if e == "all" || e == eventType {
+			return true
+		}
+	}
+	return false
 }
 
 type DiscordConfig struct {
-	Enabled   bool     `yaml:"enabled"`
-	BotToken  string   `yaml:"-"` // from env only
-	ChannelID string   `yaml:"-"` // from env only
-	Events    []string `yaml:"events"`
+	Enabled   bool      `yaml:"enabled"`
+	BotToken  string    `yaml:"-"` // from env only
+	ChannelID string    `yaml:"-"` // from env only
+	Events    EventList `yaml:"events"`
+
+	AdminChannelID  string `yaml:"-"`                 // from env only; receives moderation events
+	ModeratorRoleID string `yaml:"moderator_role_id"` // role pinged by in-game /report
+	VoiceChannelID  string `yaml:"voice_channel_id"`  // limit /discord-online to one voice channel
 }
 
 type LokiConfig struct {
-	Enabled bool        `yaml:"enabled"`
-	Events  interface{} `yaml:"events"` // "all" or []string
+	Enabled bool      `yaml:"enabled"`
+	Events  EventList `yaml:"events"`
+	Audit   bool      `yaml:"audit"` // moderation events to the audit stream, regardless of events
+}
+
+type RichTextConfig struct {
+	MapURL string            `yaml:"map_url"` // web map link for [gps] tags, e.g. https://map.example.com/#/{surface}/{x}/{y}
+	Emoji  map[string]string `yaml:"emoji"`   // prototype name -> emoji, e.g. iron-plate: "<:iron_plate:123>"
+}
+
+type InboundConfig struct {
+	MaxLength       int             `yaml:"max_length"`      // max runes per message shown in game
+	MaxRawLength    int             `yaml:"max_raw_length"`  // longer messages are dropped instead of truncated
+	RichTextAllow   []string        `yaml:"rich_text_allow"` // tags players may use from chat; empty = all not denied
+	RichTextDeny    []string        `yaml:"rich_text_deny"`
+	RateLimit       RateLimitConfig `yaml:"rate_limit"`
+	WordFilter      []string        `yaml:"word_filter"`      // case-insensitive substrings; matching messages are dropped
+	BlockedUsers    []string        `yaml:"blocked_users"`    // platform user IDs (e.g. Discord snowflakes)
+	NotifyThrottled bool            `yaml:"notify_throttled"` // react to dropped messages so authors know
+}
+
+type RateLimitConfig struct {
+	Window          time.Duration `yaml:"window"`
+	PerAuthor       int           `yaml:"per_author"` // messages per author per window, 0 = unlimited
+	Global          int           `yaml:"global"`     // messages across all authors per window, 0 = unlimited
+	DuplicateWindow time.Duration `yaml:"duplicate_window"`
+}
+
+type LinkingConfig struct {
+	Enabled bool          `yaml:"enabled"`
+	Path    string        `yaml:"path"`     // JSON file with Discord <-> Factorio links
+	CodeTTL time.Duration `yaml:"code_ttl"` // how long a /link-discord code stays valid
+}
+
+type HealthConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Listen  string `yaml:"listen"` // address for /healthz, /readyz and /status
+}
+
+type ShutdownConfig struct {
+	Timeout        time.Duration `yaml:"timeout"`         // for draining queues, and again for flushing telemetry
+	GoodbyeMessage string        `yaml:"goodbye_message"` // posted to chat channels on shutdown; empty = none
 }
 
 func defaultConfig() Config {
 	return Config{
 		RCON: RCONConfig{
-			Host: "localhost",
-			Port: "27015",
+			Host:     "localhost",
+			Port:     "27015",
+			Mode:     ModeAuto,
+			PoolSize: 3,
+			Timeout:  10 * time.Second,
 		},
 		Factorio: FactorioConfig{
-			Namespace: "factorio",
-			PodLabel:  "app=factorio-factorio-server-charts",
+			LogSource:       LogSourceKubernetes,
+			Namespace:       "factorio",
+			PodLabel:        "app=factorio-factorio-server-charts",
+			LogFile:         "/opt/factorio/factorio-current.log",
+			DockerSocket:    "/var/run/docker.sock",
+			DockerContainer: "factorio",
+			JournaldUnit:    "factorio",
 		},
 		OTel: OTelConfig{
 			ServiceName: "factorio-exporter",
@@ -73,52 +186,93 @@ func defaultConfig() Config {
 		Metrics: MetricsConfig{
 			Enabled:  true,
 			Interval: 15 * time.Second,
+			PageSize: 200,
 		},
 		Events: EventsConfig{
 			Enabled:      true,
 			PollInterval: 2 * time.Second,
-			Types:        []string{"all"},
+			Types:        EventList{"all"},
+			Dedup: DedupConfig{
+				Enabled: true,
+				Window:  30 * time.Second,
+				Rules: []DedupRule{
+					{Types: []string{"research", "research_finished"}, Keys: []string{"name"}},
+					{Types: []string{"rocket", "rocket_launch_ordered"}, Window: 10 * time.Second},
+				},
+			},
 		},
 		Discord: DiscordConfig{
 			Enabled: true,
-			Events:  []string{"all"},
+			Events:  EventList{"all"},
 		},
 		Loki: LokiConfig{
 			Enabled: true,
-			Events:  "all",
+			Events:  EventList{"all"},
+			Audit:   true,
+		},
+		Inbound: InboundConfig{
+			MaxLength:     200,
+			MaxRawLength:  1000,
+			RichTextAllow: []string{"item", "fluid", "recipe", "entity", "technology", "virtual-signal", "planet", "quality"},
+			RateLimit: RateLimitConfig{
+				Window:          time.Minute,
+				PerAuthor:       10,
+				Global:          60,
+				DuplicateWindow: 30 * time.Second,
+			},
+			NotifyThrottled: true,
+		},
+		Linking: LinkingConfig{
+			Path:    "/data/links.json",
+			CodeTTL: 10 * time.Minute,
+		},
+		Health: HealthConfig{
+			Enabled: true,
+			Listen:  ":8080",
+		},
+		Shutdown: ShutdownConfig{
+			Timeout: 10 * time.Second,
 		},
 	}
 }
 
 func loadConfig() (Config, error) {
+	cfg, err := readConfig(configPath())
+	if err != nil {
+		return cfg, err
+	}
+	if cfg.RCON.Password == "" {
+		return cfg, fmt.Errorf("RCON_PASSWORD (or RCON_PASSWORD_FILE) env is required")
+	}
+	return cfg, nil
+}
+
+// readConfig builds the effective config from defaults, the file at path and
+// the environment, and validates it. Secrets are not required, so it can
+// check a config without them (see check-config).
+func readConfig(path string) (Config, error) {
 	cfg := defaultConfig()
 
-	configPath := envOr("CONFIG_PATH", "/etc/factorio-exporter/config.yaml")
-	data, err := os.ReadFile(configPath)
-	if err == nil {
-		if err := yaml.Unmarshal(data, &cfg); err != nil {
-			return cfg, fmt.Errorf("parse config %s: %w", configPath, err)
+	// config file is optional — missing file is not an error
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&cfg); err != nil && err != io.EOF {
+			return cfg, fmt.Errorf("parse config %s: %w", path, err)
 		}
+	case !errors.Is(err, os.ErrNotExist):
+		return cfg, fmt.Errorf("read config: %w", err)
 	}
-	// config file is optional — missing file is not an error
 
 	// Env overrides (secrets + runtime values)
-	cfg.RCON.Password = os.Getenv("RCON_PASSWORD")
-	if v := os.Getenv("RCON_HOST"); v != "" {
-		cfg.RCON.Host = v
-	}
-	if v := os.Getenv("RCON_PORT"); v != "" {
-		cfg.RCON.Port = v
+	if err := applyEnv("", reflect.ValueOf(&cfg).Elem()); err != nil {
+		return cfg, err
 	}
-	cfg.Discord.BotToken = os.Getenv("DISCORD_BOT_TOKEN")
-	cfg.Discord.ChannelID = os.Getenv("DISCORD_CHANNEL_ID")
 
-	if cfg.RCON.Password == "" {
-		return cfg, fmt.Errorf("RCON_PASSWORD env is required")
-	}
-
-	if cfg.Discord.BotToken != "" && cfg.Discord.ChannelID == "" {
-		return cfg, fmt.Errorf("DISCORD_CHANNEL_ID is required when DISCORD_BOT_TOKEN is set")
+	if err := cfg.validate(); err != nil {
+		return cfg, err
 	}
 
 	if cfg.Discord.BotToken == "" {
@@ -128,48 +282,214 @@ func loadConfig() (Config, error) {
 	return cfg, nil
 }
 
-// lokiEventsAllowed returns whether a given event type should be sent to Loki.
-func (c *Config) lokiEventAllowed(eventType string) bool {
-	if !c.Loki.Enabled {
-		return false
+// legacyEnv maps config paths to the variable names read before the FE_
+// ones existed. They still work; the FE_ name wins when both are set.
+var legacyEnv = map[string]string{
+	"rcon.host":                "RCON_HOST",
+	"rcon.port":                "RCON_PORT",
+	"rcon.password":            "RCON_PASSWORD",
+	"discord.bot_token":        "DISCORD_BOT_TOKEN",
+	"discord.channel_id":       "DISCORD_CHANNEL_ID",
+	"discord.admin_channel_id": "DISCORD_ADMIN_CHANNEL_ID",
+}
+
+// envName is the variable that overrides the config field at path, e.g.
+// FE_INBOUND_RATE_LIMIT_WINDOW for inbound.rate_limit.window.
+func envName(path string) string {
+	return "FE_" + strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+}
+
+// applyEnv overrides config fields from the environment. Lists are
+// comma-separated (FE_EVENTS_TYPES=chat,join); structured fields such as
+// log_patterns, dedup rules or emoji take YAML or JSON. Empty variables are
+// ignored.
+func applyEnv(prefix string, v reflect.Value) error {
+	var errs []error
+	for i := 0; i < v.NumField(); i++ {
+		path := configFieldName(v.Type().Field(i))
+		if prefix != "" {
+			path = prefix + "." + path
+		}
+		f := v.Field(i)
+		if f.Kind() == reflect.Struct {
+			errs = append(errs, applyEnv(path, f))
+			continue
+		}
+		for _, name := range []string{legacyEnv[path], envName(path)} {
+			if name == "" {
+				continue
+			}
+			val, err := lookupEnv(name)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if val == "" {
+				continue
+			}
+			if err := setConfigField(f, val); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+		}
 	}
-	if s, ok := c.Loki.Events.(string); ok && s == "all" {
-		return true
+	return errors.Join(errs...)
+}
+
+// lookupEnv returns the value of name, or else the content of the file named
+// by name_FILE (Kubernetes and Docker secrets), without trailing newlines.
+func lookupEnv(name string) (string, error) {
+	if v := os.Getenv(name); v != "" {
+		return v, nil
 	}
-	if list, ok := c.Loki.Events.([]interface{}); ok {
-		for _, v := range list {
-			if s, ok := v.(string); ok && s == eventType {
-				return true
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("%s_FILE: %w", name, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func setConfigField(f reflect.Value, val string) error {
+	switch {
+	case f.Kind() == reflect.String:
+		f.SetString(val)
+	case f.Kind() == reflect.Slice && f.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(val, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		f.Set(reflect.ValueOf(items).Convert(f.Type()))
+	default:
+		// Numbers, booleans and durations, or YAML for structured fields.
+		ptr := reflect.New(f.Type())
+		dec := yaml.NewDecoder(strings.NewReader(val))
+		dec.KnownFields(true)
+		if err := dec.Decode(ptr.Interface()); err != nil {
+			if k := f.Kind(); k != reflect.Slice && k != reflect.Map {
+				return fmt.Errorf("invalid %s %q", f.Type(), val)
 			}
+			return err
 		}
+		f.Set(ptr.Elem())
 	}
-	return false
+	return nil
 }
 
-// discordEventAllowed returns whether a given event type should be sent to Discord.
-func (c *Config) discordEventAllowed(eventType string) bool {
-	if !c.Discord.Enabled {
-		return false
+// validate checks values and combinations of fields, reporting every
+// problem at once.
+func (c *Config) validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
 	}
-	for _, e := range c.Discord.Events {
-		if e == "all" || e == eventType {
+
+	switch c.RCON.Mode {
+	case ModeAuto, ModeSC, ModeCompanion:
+	default:
+		check(false, "rcon.mode must be %q, %q or %q, got %q", ModeAuto, ModeSC, ModeCompanion, c.RCON.Mode)
+	}
+	check(c.RCON.PoolSize >= 1, "rcon.pool_size must be at least 1, got %d", c.RCON.PoolSize)
+	check(c.RCON.Timeout >= 0, "rcon.timeout must not be negative")
+
+	switch c.Factorio.LogSource {
+	case LogSourceKubernetes:
+		check(c.Factorio.Namespace != "" && c.Factorio.PodLabel != "", "factorio.namespace and factorio.pod_label are required for log_source kubernetes")
+	case LogSourceFile:
+		check(c.Factorio.LogFile != "", "factorio.log_file is required for log_source file")
+	case LogSourceDocker:
+		check(c.Factorio.DockerSocket != "" && c.Factorio.DockerContainer != "", "factorio.docker_socket and factorio.docker_container are required for log_source docker")
+	case LogSourceJournald:
+		check(c.Factorio.JournaldUnit != "", "factorio.journald_unit is required for log_source journald")
+	default:
+		check(false, "factorio.log_source must be %q, %q, %q or %q, got %q",
+			LogSourceKubernetes, LogSourceFile, LogSourceDocker, LogSourceJournald, c.Factorio.LogSource)
+	}
+	for i, p := range c.Factorio.LogPatterns {
+		check(p.Type != "", "factorio.log_patterns[%d]: type is required", i)
+	}
+	if _, err := compileLogPatterns(c.Factorio.LogPatterns); err != nil {
+		errs = append(errs, fmt.Errorf("factorio.log_patterns: %w", err))
+	}
+
+	check(c.Metrics.Interval > 0, "metrics.interval must be positive")
+	check(c.Metrics.PageSize >= 1, "metrics.page_size must be at least 1, got %d", c.Metrics.PageSize)
+	check(!c.Events.Enabled || c.Events.PollInterval > 0, "events.poll_interval must be positive")
+
+	// Event types: documented ones plus those added by custom log patterns.
+	known := func(t string) bool {
+		if t == "all" || knownEventType(t) {
 			return true
 		}
+		for _, p := range c.Factorio.LogPatterns {
+			if p.Type == t {
+				return true
+			}
+		}
+		return false
 	}
-	return false
+	checkEvents := func(field string, types []string) {
+		for _, t := range types {
+			check(known(t), "%s: unknown event type %q (see factorio-exporter schema)", field, t)
+		}
+	}
+	checkEvents("events.types", c.Events.Types)
+	checkEvents("discord.events", c.Discord.Events)
+	checkEvents("loki.events", c.Loki.Events)
+	check(c.Events.Dedup.Window >= 0, "events.dedup.window must not be negative")
+	for i, r := range c.Events.Dedup.Rules {
+		check(len(r.Types) >= 2, "events.dedup.rules[%d]: at least two types are required", i)
+		checkEvents(fmt.Sprintf("events.dedup.rules[%d].types", i), r.Types)
+		check(r.Window >= 0, "events.dedup.rules[%d].window must not be negative", i)
+	}
+
+	check(c.Discord.BotToken == "" || c.Discord.ChannelID != "", "DISCORD_CHANNEL_ID is required when DISCORD_BOT_TOKEN is set")
+
+	check(c.Inbound.MaxLength >= 1, "inbound.max_length must be at least 1, got %d", c.Inbound.MaxLength)
+	check(c.Inbound.MaxRawLength == 0 || c.Inbound.MaxRawLength >= c.Inbound.MaxLength,
+		"inbound.max_raw_length (%d) must be 0 or at least inbound.max_length (%d)", c.Inbound.MaxRawLength, c.Inbound.MaxLength)
+	rl := c.Inbound.RateLimit
+	check(rl.PerAuthor >= 0 && rl.Global >= 0, "inbound.rate_limit.per_author and global must not be negative")
+	check(rl.Window > 0 || (rl.PerAuthor == 0 && rl.Global == 0), "inbound.rate_limit.window must be positive when a limit is set")
+
+	if c.Linking.Enabled {
+		check(c.Linking.Path != "", "linking.path is required when linking is enabled")
+		check(c.Linking.CodeTTL > 0, "linking.code_ttl must be positive")
+	}
+	check(!c.Health.Enabled || c.Health.Listen != "", "health.listen is required when health is enabled")
+	check(c.Shutdown.Timeout > 0, "shutdown.timeout must be positive")
+
+	return errors.Join(errs...)
+}
+
+// lokiEventAllowed returns whether a given event type should be sent to Loki.
+func (c *Config) lokiEventAllowed(eventType string) bool {
+	return c.Loki.Enabled && c.Loki.Events.Allows(eventType)
+}
+
+// discordEventAllowed returns whether a given event type should be sent to the
+// main Discord channel. Moderation and command events must be listed by name;
+// "all" doesn't include them.
+func (c *Config) discordEventAllowed(eventType string) bool {
+	if isModerationEvent(eventType) {
+		return c.Discord.Enabled && slices.Contains(c.Discord.Events, eventType)
+	}
+	return c.Discord.Enabled && c.Discord.Events.Allows(eventType)
 }
 
 // rconEventEnabled returns whether a given RCON event type should be registered.
 func (c *Config) rconEventEnabled(eventType string) bool {
-	if !c.Events.Enabled {
-		return false
-	}
-	for _, e := range c.Events.Types {
-		if e == "all" || e == eventType {
-			return true
-		}
-	}
-	return false
+	return c.Events.Enabled && c.Events.Types.Allows(eventType)
+}
+
+func configPath() string {
+	return envOr("CONFIG_PATH", "/etc/factorio-exporter/config.yaml")
 }
 
 func envOr(key, fallback string) string {
@@ -178,3 +498,66 @@ func envOr(key, fallback string) string {
 	}
 	return fallback
 }
+
+// secretConfigFields are redacted when the config is printed.
+var secretConfigFields = map[string]bool{
+	"rcon.password":     true,
+	"discord.bot_token": true,
+}
+
+// redactedYAML renders the effective config, including fields set only from
+// the environment, with secrets replaced by "<redacted>".
+func (c *Config) redactedYAML() ([]byte, error) {
+	node, err := configNode("", reflect.ValueOf(*c))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), enc.Close()
+}
+
+func configNode(path string, v reflect.Value) (*yaml.Node, error) {
+	switch {
+	case secretConfigFields[path]:
+		if !v.IsZero() {
+			v = reflect.ValueOf("<redacted>")
+		}
+	case v.Type() == reflect.TypeOf(time.Duration(0)):
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: v.Interface().(time.Duration).String()}, nil
+	case v.Kind() == reflect.Struct:
+		m := &yaml.Node{Kind: yaml.MappingNode}
+		for i := 0; i < v.NumField(); i++ {
+			name := configFieldName(v.Type().Field(i))
+			child := name
+			if path != "" {
+				child = path + "." + name
+			}
+			n, err := configNode(child, v.Field(i))
+			if err != nil {
+				return nil, err
+			}
+			m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, n)
+		}
+		return m, nil
+	case v.Kind() == reflect.Slice && !v.IsNil():
+		seq := &yaml.Node{Kind: yaml.SequenceNode}
+		for i := 0; i < v.Len(); i++ {
+			n, err := configNode(fmt.Sprintf("%s[%d]", path, i), v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			seq.Content = append(seq.Content, n)
+		}
+		return seq, nil
+	}
+	n := &yaml.Node{}
+	if err := n.Encode(v.Interface()); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const ticksPerSecond = 60
+
+// DedupRule declares event types that describe the same happening. An event
+// of one of the types is a duplicate of an earlier one with equal key fields
+// within the window that came from another source or has another type; only
+// the first one is delivered. Repeats from the same source are kept, so two
+// rockets launched close together are both reported.
+type DedupRule struct {
+	Types  []string      `yaml:"types"`
+	Keys   []string      `yaml:"keys"`   // Extra fields (or "player") that must match
+	Window time.Duration `yaml:"window"` // 0 = DedupConfig.Window
+}
+
+type DedupConfig struct {
+	Enabled bool          `yaml:"enabled"`
+	Window  time.Duration `yaml:"window"`
+	Rules   []DedupRule   `yaml:"rules"`
+}
+
+// Correlator suppresses events that another source already reported, e.g.
+// "research" from the server log and "research_finished" from RCON. Events
+// that both carry a game tick are compared by tick, others by arrival time.
+type Correlator struct {
+	rules  []DedupRule
+	byType map[string][]int // event type -> rule indexes
+
+	mu     sync.Mutex
+	recent []seenEvent
+}
+
+type seenEvent struct {
+	rule    int
+	key     string
+	source  string
+	typ     string
+	tick    int64
+	time    time.Time
+	matched bool // its counterpart from the other source was already dropped
+}
+
+func NewCorrelator(cfg DedupConfig) *Correlator {
+	c := &Correlator{byType: make(map[string][]int)}
+	if !cfg.Enabled {
+		return c
+	}
+	for _, r := range cfg.Rules {
+		if r.Window <= 0 {
+			r.Window = cfg.Window
+		}
+		c.rules = append(c.rules, r)
+		for _, t := range r.Types {
+			c.byType[t] = append(c.byType[t], len(c.rules)-1)
+		}
+	}
+	return c
+}
+
+// Duplicate reports whether e repeats an event another source reported
+// within a rule's window, and remembers e for each rule it doesn't repeat.
+func (c *Correlator) Duplicate(e GameEvent) bool {
+	rules := c.byType[e.Type]
+	if len(rules) == 0 {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire(e.Time)
+
+	dup := false
+	for _, ri := range rules {
+		if c.match(ri, e) {
+			dup = true
+			continue
+		}
+		c.recent = append(c.recent, seenEvent{rule: ri, key: c.key(ri, e), source: e.Source, typ: e.Type, tick: e.Tick, time: e.Time})
+	}
+	return dup
+}
+
+// match marks the first unmatched event of rule that e duplicates, and
+// reports whether there was one. Each remembered event absorbs at most one
+// duplicate.
+func (c *Correlator) match(rule int, e GameEvent) bool {
+	key := c.key(rule, e)
+	for i := range c.recent {
+		s := &c.recent[i]
+		if s.rule != rule || s.matched || s.key != key || (s.source == e.Source && s.typ == e.Type) {
+			continue
+		}
+		if c.within(rule, *s, e) {
+			s.matched = true
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Correlator) key(rule int, e GameEvent) string {
+	parts := make([]string, len(c.rules[rule].Keys))
+	for i, k := range c.rules[rule].Keys {
+		if k == "player" {
+			parts[i] = e.Player
+		} else {
+			parts[i] = e.Extra[k]
+		}
+	}
+	return strings.Join(parts, "\x00")
+}
+
+func (c *Correlator) within(rule int, s seenEvent, e GameEvent) bool {
+	window := c.rules[rule].Window
+	if s.tick > 0 && e.Tick > 0 {
+		d := e.Tick - s.tick
+		if d < 0 {
+			d = -d
+		}
+		return d <= int64(window.Seconds()*ticksPerSecond)
+	}
+	d := e.Time.Sub(s.time)
+	if d < 0 {
+		d = -d
+	}
+	return d <= window
+}
+
+// expire drops remembered events older than their rule's window.
+func (c *Correlator) expire(now time.Time) {
+	kept := c.recent[:0]
+	for _, s := range c.recent {
+		if now.Sub(s.time) <= c.rules[s.rule].Window {
+			kept = append(kept, s)
+		}
+	}
+	c.recent = kept
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCorrelator(t *testing.T) {
+	t0 := time.Date(2024, 10, 21, 10, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return t0.Add(d) }
+	research := func(source, typ, name string, d time.Duration) GameEvent {
+		return GameEvent{Type: typ, Source: source, Extra: map[string]string{"name": name}, Time: at(d)}
+	}
+	rocket := func(source, typ string, d time.Duration) GameEvent {
+		return GameEvent{Type: typ, Source: source, Time: at(d)}
+	}
+
+	tests := []struct {
+		name   string
+		events []GameEvent
+		want   []bool // Duplicate result per event
+	}{
+		{"same research from log and RCON",
+			[]GameEvent{research(SourceLog, "research", "automation", 0), research(SourceRCON, "research_finished", "automation", time.Second)},
+			[]bool{false, true}},
+		{"RCON first",
+			[]GameEvent{research(SourceRCON, "research_finished", "automation", 0), research(SourceLog, "research", "automation", time.Second)},
+			[]bool{false, true}},
+		{"different keys",
+			[]GameEvent{research(SourceLog, "research", "automation", 0), research(SourceRCON, "research_finished", "logistics", time.Second)},
+			[]bool{false, false}},
+		{"outside the window",
+			[]GameEvent{research(SourceLog, "research", "automation", 0), research(SourceRCON, "research_finished", "automation", time.Minute)},
+			[]bool{false, false}},
+		{"repeats from one source are kept",
+			[]GameEvent{rocket(SourceLog, "rocket", 0), rocket(SourceLog, "rocket", 2*time.Second)},
+			[]bool{false, false}},
+		{"two silos, both sources",
+			[]GameEvent{
+				rocket(SourceLog, "rocket", 0),
+				rocket(SourceLog, "rocket", time.Second),
+				rocket(SourceRCON, "rocket_launch_ordered", 2*time.Second),
+				rocket(SourceRCON, "rocket_launch_ordered", 3*time.Second),
+				rocket(SourceRCON, "rocket_launch_ordered", 4*time.Second),
+			},
+			[]bool{false, false, true, true, false}},
+	}
+
+	cfg := defaultConfig().Events.Dedup
+	for _, tt := range tests {
+		c := NewCorrelator(cfg)
+		for i, e := range tt.events {
+			if got := c.Duplicate(e); got != tt.want[i] {
+				t.Errorf("%s: event %d (%s from %s): Duplicate = %v, want %v", tt.name, i, e.Type, e.Source, got, tt.want[i])
+			}
+		}
+	}
+}
+
+// TestCorrelatorRules checks that a match in one rule doesn't stop the event
+// from being remembered for the others.
+func TestCorrelatorRules(t *testing.T) {
+	t0 := time.Date(2024, 10, 21, 10, 0, 0, 0, time.UTC)
+	c := NewCorrelator(DedupConfig{Enabled: true, Window: 30 * time.Second, Rules: []DedupRule{
+		{Types: []string{"a", "b"}},
+		{Types: []string{"a", "c"}},
+	}})
+	steps := []struct {
+		e    GameEvent
+		want bool
+	}{
+		{GameEvent{Type: "b", Source: SourceRCON, Time: t0}, false},
+		{GameEvent{Type: "a", Source: SourceLog, Time: t0.Add(time.Second)}, true},
+		{GameEvent{Type: "c", Source: SourceRCON, Time: t0.Add(2 * time.Second)}, true},
+	}
+	for i, s := range steps {
+		if got := c.Duplicate(s.e); got != s.want {
+			t.Errorf("step %d (%s): Duplicate = %v, want %v", i, s.e.Type, got, s.want)
+		}
+	}
+
+	if NewCorrelator(DedupConfig{Window: time.Minute, Rules: []DedupRule{{Types: []string{"a", "b"}}}}).
+		Duplicate(GameEvent{Type: "a", Time: t0}) {
+		t.Error("disabled correlator reported a duplicate")
+	}
+}
@@ -2,8 +2,13 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 )
@@ -13,10 +18,45 @@ type DiscordChannel struct {
 	channelID string
 	inbound   chan InboundMessage
 	botUserID string
-	cfg       *Config
+	cfg       *LiveConfig
+	linker    *AccountLinker
+	tel       *Telemetry
+
+	mu           sync.Mutex
+	guildID      string                   // guild of the bridged channel, set by Start
+	speakers     map[string]recentSpeaker // user ID -> last message in the bridged channel
+	lastRolePing time.Time
+}
+
+type recentSpeaker struct {
+	name string
+	at   time.Time
 }
 
-func NewDiscordChannel(token, channelID string, cfg *Config) (*DiscordChannel, error) {
+// recentSpeakerWindow is how long a chat participant counts as "online".
+const recentSpeakerWindow = 15 * time.Minute
+
+// rolePingInterval limits how often /report pings the moderator role.
+const rolePingInterval = 5 * time.Minute
+
+var linkCommands = []*discordgo.ApplicationCommand{
+	{
+		Name:        "link",
+		Description: "Link your Discord account to your Factorio player",
+		Options: []*discordgo.ApplicationCommandOption{{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "code",
+			Description: "Code from /link-discord in game",
+			Required:    true,
+		}},
+	},
+	{
+		Name:        "unlink",
+		Description: "Unlink your Discord account from your Factorio player",
+	},
+}
+
+func NewDiscordChannel(token, channelID string, cfg *LiveConfig, linker *AccountLinker, tel *Telemetry) (*DiscordChannel, error) {
 	session, err := discordgo.New("Bot " + token)
 	if err != nil {
 		return nil, fmt.Errorf("discordgo session: %w", err)
@@ -27,10 +67,25 @@ func NewDiscordChannel(token, channelID string, cfg *Config) (*DiscordChannel, e
 		channelID: channelID,
 		inbound:   make(chan InboundMessage, 100),
 		cfg:       cfg,
+		linker:    linker,
+		tel:       tel,
+		speakers:  make(map[string]recentSpeaker),
 	}
 
-	session.Identify.Intents = discordgo.IntentsGuildMessages | discordgo.IntentMessageContent
+	session.Identify.Intents = discordgo.IntentsGuilds | discordgo.IntentsGuildMessages |
+		discordgo.IntentMessageContent | discordgo.IntentsGuildVoiceStates
 	session.AddHandler(dc.onMessage)
+	session.AddHandler(dc.onInteraction)
+	// Gateway state for /readyz and factorio_exporter_up.
+	session.AddHandler(func(_ *discordgo.Session, _ *discordgo.Connect) {
+		tel.Report(context.Background(), "discord", nil)
+	})
+	session.AddHandler(func(_ *discordgo.Session, _ *discordgo.Resumed) {
+		tel.Report(context.Background(), "discord", nil)
+	})
+	session.AddHandler(func(_ *discordgo.Session, _ *discordgo.Disconnect) {
+		tel.Report(context.Background(), "discord", errors.New("gateway disconnected"))
+	})
 
 	return dc, nil
 }
@@ -39,18 +94,39 @@ func (dc *DiscordChannel) Name() string { return "Discord" }
 
 func (dc *DiscordChannel) Start(ctx context.Context) error {
 	if err := dc.session.Open(); err != nil {
+		dc.tel.Report(ctx, "discord", err)
 		return fmt.Errorf("discord open: %w", err)
 	}
 	dc.botUserID = dc.session.State.User.ID
 	log.Printf("discord bot connected as %s", dc.session.State.User.Username)
 
+	if ch, err := dc.session.Channel(dc.channelID); err != nil {
+		log.Printf("discord channel lookup: %v", err)
+	} else {
+		dc.mu.Lock()
+		dc.guildID = ch.GuildID
+		dc.mu.Unlock()
+	}
+
+	if dc.linker.Enabled() {
+		if err := dc.registerCommands(); err != nil {
+			log.Printf("discord slash commands: %v", err)
+		}
+	}
+
 	<-ctx.Done()
 	dc.session.Close()
 	return nil
 }
 
 func (dc *DiscordChannel) Send(ctx context.Context, event GameEvent) error {
-	if !dc.cfg.discordEventAllowed(event.Type) {
+	cfg := dc.cfg.Load()
+	channelID := dc.channelID
+	if isModerationEvent(event.Type) && cfg.Discord.AdminChannelID != "" {
+		// The admin channel gets every moderation event, unfiltered.
+		channelID = cfg.Discord.AdminChannelID
+	} else if event.Type != "exporter_offline" && !cfg.discordEventAllowed(event.Type) {
+		// The goodbye message is opt-in through its own setting.
 		return nil
 	}
 
@@ -59,13 +135,39 @@ func (dc *DiscordChannel) Send(ctx context.Context, event GameEvent) error {
 		return nil
 	}
 
-	_, err := dc.session.ChannelMessageSend(dc.channelID, msg)
+	// Linked players are shown as mentions, but only deaths actually ping.
+	mentions := &discordgo.MessageAllowedMentions{}
+	if id := event.Extra["discord_id"]; id != "" && event.Type == "player_died" {
+		mentions.Users = []string{id}
+	}
+	if event.Type == "report" && cfg.Discord.ModeratorRoleID != "" && dc.allowRolePing() {
+		msg += fmt.Sprintf(" <@&%s>", cfg.Discord.ModeratorRoleID)
+		mentions.Roles = []string{cfg.Discord.ModeratorRoleID}
+	}
+
+	_, err := dc.session.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content:         msg,
+		AllowedMentions: mentions,
+	})
 	if err != nil {
 		return fmt.Errorf("send to Discord: %w", err)
 	}
 	return nil
 }
 
+// allowRolePing reports whether a /report may ping the moderator role. The
+// role is pinged at most once per rolePingInterval; later reports are still
+// posted, just without the ping.
+func (dc *DiscordChannel) allowRolePing() bool {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if time.Since(dc.lastRolePing) < rolePingInterval {
+		return false
+	}
+	dc.lastRolePing = time.Now()
+	return true
+}
+
 func (dc *DiscordChannel) Messages() <-chan InboundMessage { return dc.inbound }
 
 func (dc *DiscordChannel) Close() error {
@@ -88,24 +190,186 @@ func (dc *DiscordChannel) onMessage(s *discordgo.Session, m *discordgo.MessageCr
 		author = m.Author.Username
 	}
 
+	dc.mu.Lock()
+	dc.speakers[m.Author.ID] = recentSpeaker{name: author, at: time.Now()}
+	dc.mu.Unlock()
+
 	dc.inbound <- InboundMessage{
-		Source:  "Discord",
-		Author:  author,
-		Content: m.Content,
+		ID:       m.ID,
+		Source:   "Discord",
+		Author:   author,
+		AuthorID: m.Author.ID,
+		Content:  m.Content,
+	}
+}
+
+// NotifyDropped reacts to a message that was not relayed to the game.
+func (dc *DiscordChannel) NotifyDropped(ctx context.Context, msg InboundMessage, reason string) error {
+	emoji := "🚫"
+	switch reason {
+	case dropAuthorLimit, dropGlobalLimit, dropDuplicate:
+		emoji = "🐢"
+	case dropTooLong:
+		emoji = "✂️"
+	}
+	if err := dc.session.MessageReactionAdd(dc.channelID, msg.ID, emoji); err != nil {
+		return fmt.Errorf("discord reaction: %w", err)
+	}
+	return nil
+}
+
+// Online lists users in the guild's voice channels and users who recently
+// talked in the bridged text channel.
+func (dc *DiscordChannel) Online(ctx context.Context) ([]OnlineGroup, error) {
+	var groups []OnlineGroup
+
+	if guildID := dc.guild(); guildID != "" {
+		guild, err := dc.session.State.Guild(guildID)
+		if err != nil {
+			return nil, fmt.Errorf("discord guild state: %w", err)
+		}
+		voice := OnlineGroup{Name: "voice"}
+		voiceChannelID := dc.cfg.Load().Discord.VoiceChannelID
+		for _, vs := range guild.VoiceStates {
+			if voiceChannelID != "" && vs.ChannelID != voiceChannelID {
+				continue
+			}
+			voice.Users = append(voice.Users, dc.memberName(guildID, vs.UserID))
+		}
+		groups = append(groups, voice)
+	}
+
+	chat := OnlineGroup{Name: "chat"}
+	dc.mu.Lock()
+	for id, sp := range dc.speakers {
+		if time.Since(sp.at) > recentSpeakerWindow {
+			delete(dc.speakers, id)
+			continue
+		}
+		chat.Users = append(chat.Users, sp.name)
+	}
+	dc.mu.Unlock()
+	sort.Strings(chat.Users)
+	groups = append(groups, chat)
+
+	return groups, nil
+}
+
+// guild returns the guild of the bridged channel, or "" before Start found it.
+func (dc *DiscordChannel) guild() string {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	return dc.guildID
+}
+
+func (dc *DiscordChannel) memberName(guildID, userID string) string {
+	m, err := dc.session.State.Member(guildID, userID)
+	if err != nil || m.User == nil {
+		return userID
+	}
+	switch {
+	case m.Nick != "":
+		return m.Nick
+	case m.User.GlobalName != "":
+		return m.User.GlobalName
 	}
+	return m.User.Username
+}
+
+// registerCommands creates the account linking slash commands in the guild
+// of the bridged channel.
+func (dc *DiscordChannel) registerCommands() error {
+	guildID := dc.guild()
+	if guildID == "" {
+		return fmt.Errorf("guild of channel %s unknown", dc.channelID)
+	}
+	for _, cmd := range linkCommands {
+		if _, err := dc.session.ApplicationCommandCreate(dc.botUserID, guildID, cmd); err != nil {
+			return fmt.Errorf("create /%s: %w", cmd.Name, err)
+		}
+	}
+	return nil
+}
+
+func (dc *DiscordChannel) onInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionApplicationCommand || !dc.linker.Enabled() {
+		return
+	}
+	user := i.User
+	if i.Member != nil {
+		user = i.Member.User
+	}
+	if user == nil {
+		return
+	}
+
+	var reply string
+	data := i.ApplicationCommandData()
+	switch data.Name {
+	case "link":
+		player, err := dc.linker.Redeem(data.Options[0].StringValue(), user.ID, user.Username)
+		switch {
+		case errors.Is(err, errInvalidCode):
+			reply = "That code is unknown or expired. Run `/link-discord` in game to get a new one."
+		case err != nil:
+			log.Printf("link %s: %v", user.ID, err)
+			reply = fmt.Sprintf("Linked to **%s**, but saving the link failed.", player)
+		default:
+			reply = fmt.Sprintf("Linked to Factorio player **%s**.", player)
+		}
+	case "unlink":
+		player, err := dc.linker.Unlink(user.ID)
+		switch {
+		case err != nil:
+			log.Printf("unlink %s: %v", user.ID, err)
+			reply = "Unlinking failed."
+		case player == "":
+			reply = "Your account is not linked."
+		default:
+			reply = fmt.Sprintf("Unlinked from **%s**.", player)
+		}
+	default:
+		return
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: reply,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Printf("discord interaction respond: %v", err)
+	}
+}
+
+// playerLabel renders a player name, with the linked Discord user if any.
+func playerLabel(e GameEvent) string {
+	if id := e.Extra["discord_id"]; id != "" {
+		return fmt.Sprintf("**%s** (<@%s>)", e.Player, id)
+	}
+	return fmt.Sprintf("**%s**", e.Player)
+}
+
+func reasonSuffix(e GameEvent) string {
+	if r := e.Extra["reason"]; r != "" {
+		return fmt.Sprintf(" (%s)", r)
+	}
+	return ""
 }
 
 func formatGameEvent(e GameEvent) string {
 	switch e.Type {
 	// Log-based events
 	case "chat":
-		return fmt.Sprintf("💬 **%s**: %s", e.Player, e.Message)
+		return fmt.Sprintf("💬 %s: %s", playerLabel(e), e.Message)
 	case "join":
-		return fmt.Sprintf("➡️ **%s** joined the game", e.Player)
+		return fmt.Sprintf("➡️ %s joined the game", playerLabel(e))
 	case "leave":
-		return fmt.Sprintf("⬅️ **%s** left the game", e.Player)
-	case "research":
-		return fmt.Sprintf("🔬 Research completed: **%s**", e.Extra["tech"])
+		return fmt.Sprintf("⬅️ %s left the game", playerLabel(e))
+	case "research", "research_finished":
+		return fmt.Sprintf("🔬 Research completed: **%s**", e.Extra["name"])
 	case "rocket":
 		return "🚀 **Rocket launched!**"
 
@@ -115,15 +379,15 @@ func formatGameEvent(e GameEvent) string {
 	case "research_cancelled":
 		return fmt.Sprintf("🔬 Research cancelled: **%s**", e.Extra["name"])
 	case "player_died":
-		return fmt.Sprintf("💀 **%s** died (%s)", e.Player, e.Extra["cause"])
+		return fmt.Sprintf("💀 %s died (%s)", playerLabel(e), e.Extra["cause"])
 	case "player_respawned":
-		return fmt.Sprintf("🔄 **%s** respawned", e.Player)
+		return fmt.Sprintf("🔄 %s respawned", playerLabel(e))
 	case "player_changed_surface":
-		return fmt.Sprintf("🌍 **%s** traveled to **%s**", e.Player, e.Extra["surface"])
+		return fmt.Sprintf("🌍 %s traveled to **%s**", playerLabel(e), e.Surface)
 	case "player_promoted":
-		return fmt.Sprintf("⬆️ **%s** promoted to admin", e.Player)
+		return fmt.Sprintf("⬆️ %s promoted to admin", playerLabel(e))
 	case "player_demoted":
-		return fmt.Sprintf("⬇️ **%s** demoted from admin", e.Player)
+		return fmt.Sprintf("⬇️ %s demoted from admin", playerLabel(e))
 	case "rocket_launch_ordered":
 		return "🚀 Rocket launch ordered"
 	case "platform_state_changed":
@@ -139,6 +403,61 @@ func formatGameEvent(e GameEvent) string {
 	case "tag_added":
 		return fmt.Sprintf("📍 Map tag added: **%s**", e.Extra["text"])
 
+	// Moderation
+	case "kick":
+		return fmt.Sprintf("👢 %s was kicked by **%s**%s", playerLabel(e), e.Extra["actor"], reasonSuffix(e))
+	case "ban":
+		return fmt.Sprintf("🔨 %s was banned by **%s**%s", playerLabel(e), e.Extra["actor"], reasonSuffix(e))
+	case "unban":
+		return fmt.Sprintf("🕊️ %s was unbanned by **%s**", playerLabel(e), e.Extra["actor"])
+	case "promote":
+		return fmt.Sprintf("⬆️ %s was promoted to admin by **%s**", playerLabel(e), e.Extra["actor"])
+	case "demote":
+		return fmt.Sprintf("⬇️ %s was demoted from admin by **%s**", playerLabel(e), e.Extra["actor"])
+	case "command":
+		return fmt.Sprintf("⌨️ **%s** ran `%s`", e.Extra["actor"], strings.ReplaceAll(e.Extra["command"], "`", "'"))
+
+	// Kubernetes pod lifecycle
+	case "server_ready":
+		return fmt.Sprintf("🟢 Server pod **%s** is ready", e.Extra["pod"])
+	case "server_not_ready":
+		return fmt.Sprintf("🟠 Server pod **%s** is not ready", e.Extra["pod"])
+	case "server_restarted":
+		return fmt.Sprintf("🔄 Server restarted (restart #%s)", e.Extra["restarts"])
+	case "server_crashed":
+		if code := e.Extra["exit_code"]; code != "" {
+			return fmt.Sprintf("🔴 Server crashed (%s, exit code %s)", e.Extra["reason"], code)
+		}
+		return fmt.Sprintf("🔴 Server crashed (%s)", e.Extra["reason"])
+	case "server_updated":
+		return fmt.Sprintf("⬆️ Server updated to **%s**", e.Extra["image"])
+	case "server_waiting":
+		return fmt.Sprintf("⏳ Server container waiting: **%s**", e.Extra["reason"])
+
+	// Server log lifecycle
+	case "server_starting":
+		return fmt.Sprintf("🟡 Server starting (v%s)", e.Extra["version"])
+	case "server_loading":
+		return fmt.Sprintf("🟡 Loading map **%s**", e.Extra["map"])
+	case "server_started":
+		return fmt.Sprintf("🟢 Server is up (v%s, %s mods)", e.Extra["version"], e.Extra["mods"])
+	case "server_stopped":
+		return fmt.Sprintf("⚪ Server stopped (%s)", e.Extra["reason"])
+	case "desync":
+		return "⚠️ Desync detected"
+	case "server_error":
+		return fmt.Sprintf("⚠️ Server error: %s", e.Extra["message"])
+
+	// In-game commands
+	case "discord_message":
+		return fmt.Sprintf("📣 %s: %s", playerLabel(e), e.Extra["text"])
+	case "report":
+		return fmt.Sprintf("🚨 Report from %s: %s", playerLabel(e), e.Extra["text"])
+
+	// Exporter lifecycle
+	case "exporter_offline":
+		return "⚫ " + e.Message
+
 	default:
 		return ""
 	}
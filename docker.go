@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// DockerLogSource follows a container's logs through the Docker engine API
+// on its unix socket.
+type DockerLogSource struct {
+	container string
+	client    *http.Client
+	resume    lineResume
+}
+
+func NewDockerLogSource(socket, container string) *DockerLogSource {
+	dialer := &net.Dialer{}
+	return &DockerLogSource{
+		container: container,
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+func (s *DockerLogSource) Name() string { return "container " + s.container }
+
+func (s *DockerLogSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	tty, err := s.containerTTY(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resume after the last delivered line, also across container
+	// restarts; since has second precision, so the boundary is de-duplicated.
+	q := url.Values{"follow": {"1"}, "stdout": {"1"}, "stderr": {"1"}, "timestamps": {"1"}}
+	if last := s.resume.last(); last.IsZero() {
+		q.Set("tail", "0")
+	} else {
+		q.Set("since", strconv.FormatInt(last.Unix(), 10))
+	}
+
+	resp, err := s.get(ctx, "/containers/"+url.PathEscape(s.container)+"/logs?"+q.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("container logs: %w", err)
+	}
+	var body io.ReadCloser = resp.Body
+	if !tty {
+		body = newDockerDemuxReader(resp.Body)
+	}
+	return newTimestampedReader(body, &s.resume), nil
+}
+
+// containerTTY reports whether the container has a TTY; only then are its
+// logs a raw stream rather than multiplexed frames.
+func (s *DockerLogSource) containerTTY(ctx context.Context) (bool, error) {
+	resp, err := s.get(ctx, "/containers/"+url.PathEscape(s.container)+"/json")
+	if err != nil {
+		return false, fmt.Errorf("inspect container: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var info struct {
+		Config struct {
+			Tty bool `json:"Tty"`
+		} `json:"Config"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return false, fmt.Errorf("inspect container: %w", err)
+	}
+	return info.Config.Tty, nil
+}
+
+func (s *DockerLogSource) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://docker"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s", resp.Status, string(body))
+	}
+	return resp, nil
+}
+
+// dockerDemuxReader strips the 8-byte frame headers Docker puts in front of
+// each stdout/stderr chunk of a non-TTY container.
+type dockerDemuxReader struct {
+	body      io.ReadCloser
+	r         *bufio.Reader
+	remaining uint32
+}
+
+func newDockerDemuxReader(body io.ReadCloser) *dockerDemuxReader {
+	return &dockerDemuxReader{body: body, r: bufio.NewReader(body)}
+}
+
+func (d *dockerDemuxReader) Read(p []byte) (int, error) {
+	for d.remaining == 0 {
+		var header [8]byte
+		if _, err := io.ReadFull(d.r, header[:]); err != nil {
+			return 0, err
+		}
+		d.remaining = binary.BigEndian.Uint32(header[4:])
+	}
+	if uint32(len(p)) > d.remaining {
+		p = p[:d.remaining]
+	}
+	n, err := d.r.Read(p)
+	d.remaining -= uint32(n)
+	return n, err
+}
+
+func (d *dockerDemuxReader) Close() error { return d.body.Close() }
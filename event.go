@@ -1,21 +1,106 @@
 package main
 
-import "time"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+)
 
-// GameEvent represents any event from the Factorio server.
+// GameEvent represents any event from the Factorio server. See schema.go for
+// the fields each event type carries.
 type GameEvent struct {
+	ID      string            // Stable hash of the event content (set by the EventPipeline)
 	Type    string            // "chat", "join", "leave", "research", "rocket", "save", "research_started", "player_died", etc.
+	Source  string            // SourceLog, SourceRCON or SourceK8s
+	Server  string            // factorio.server_name
+	Surface string            // Surface the event happened on, if known
+	Tick    int64             // Game tick (RCON events only)
 	Player  string            // Player name (empty for non-player events)
 	Message string            // Chat message content
-	Extra   map[string]string // Event-specific data (tech, cause, surface, name, etc.)
+	Extra   map[string]string // Event-specific data (name, cause, actor, etc.)
 	Time    time.Time
+
+	line string // Log line the event was parsed from, including any stream timestamp
+	seq  int    // Position among the events of the same tick in a poll
+}
+
+// eventID hashes the fields that identify an event. Events with a game tick
+// hash the tick and their position within it, and log events the line they
+// were parsed from, instead of the wall-clock time, so the same event gets
+// the same ID however late it is read.
+func eventID(e GameEvent) string {
+	h := sha256.New()
+	write := func(s string) {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	write(e.Server)
+	write(e.Source)
+	write(e.Type)
+	switch {
+	case e.Tick > 0:
+		write("tick:" + strconv.FormatInt(e.Tick, 10) + "#" + strconv.Itoa(e.seq))
+	case e.line != "":
+		write("line:" + e.line)
+	default:
+		write(e.Time.UTC().Format(time.RFC3339Nano))
+	}
+	write(e.Surface)
+	write(e.Player)
+	write(e.Message)
+	keys := make([]string, 0, len(e.Extra))
+	for k := range e.Extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		write(k)
+		write(e.Extra[k])
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// MarshalJSON encodes the event in the versioned schema (see "schema").
+func (e GameEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		SchemaVersion int            `json:"schema_version"`
+		ID            string         `json:"id"`
+		Type          string         `json:"type"`
+		Source        string         `json:"source"`
+		Server        string         `json:"server,omitempty"`
+		Surface       string         `json:"surface,omitempty"`
+		Tick          int64          `json:"tick,omitempty"`
+		Time          time.Time      `json:"time"`
+		Player        string         `json:"player,omitempty"`
+		Message       string         `json:"message,omitempty"`
+		Data          map[string]any `json:"data,omitempty"`
+	}{EventSchemaVersion, e.ID, e.Type, e.Source, e.Server, e.Surface, e.Tick, e.Time, e.Player, e.Message, typedData(e)})
+}
+
+// moderationEvents are routed to the audit stream and the admin channel.
+var moderationEvents = map[string]bool{
+	"kick":    true,
+	"ban":     true,
+	"unban":   true,
+	"promote": true,
+	"demote":  true,
+	"command": true,
+}
+
+func isModerationEvent(eventType string) bool {
+	return moderationEvents[eventType]
 }
 
 // InboundMessage represents a message from an external channel destined for Factorio.
 type InboundMessage struct {
-	Source  string // Channel name (e.g., "Discord")
-	Author  string
-	Content string
+	ID       string // Platform message ID (used for reactions/replies)
+	Source   string // Channel name (e.g., "Discord")
+	Author   string
+	AuthorID string // Platform user ID (used for rate limits and blocklists)
+	Content  string
 }
 
 // LogSubscriber receives parsed events from the LogTailer or EventPoller.
@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"strings"
 	"time"
@@ -23,19 +25,25 @@ type RCONEvent struct {
 // EventPoller registers Lua event handlers via RCON and polls the event queue.
 type EventPoller struct {
 	rcon            *RCONPool
+	companion       *Companion
 	registerScripts []string
 	pollLua         string
 	pollInterval    time.Duration
+	interval        chan time.Duration // interval changes while running
 	subscribers     []LogSubscriber
 	registered      bool
+	tel             *Telemetry
 }
 
-func NewEventPoller(pool *RCONPool, registerScripts []string, pollLua string, interval time.Duration) *EventPoller {
+func NewEventPoller(pool *RCONPool, companion *Companion, registerScripts []string, pollLua string, interval time.Duration, tel *Telemetry) *EventPoller {
 	return &EventPoller{
+		tel:             tel,
 		rcon:            pool,
+		companion:       companion,
 		registerScripts: registerScripts,
 		pollLua:         pollLua,
 		pollInterval:    interval,
+		interval:        make(chan time.Duration, 1),
 	}
 }
 
@@ -44,6 +52,7 @@ func (p *EventPoller) Subscribe(sub LogSubscriber) {
 }
 
 func (p *EventPoller) Run(ctx context.Context) {
+	ctx = WithRCONPriority(ctx, PriorityEvents)
 	p.registerWithRetry(ctx)
 
 	pollTicker := time.NewTicker(p.pollInterval)
@@ -56,21 +65,35 @@ func (p *EventPoller) Run(ctx context.Context) {
 		select {
 		case <-ctx.Done():
 			return
+		case d := <-p.interval:
+			pollTicker.Reset(d)
 		case <-pollTicker.C:
-			p.poll()
+			p.poll(ctx)
 		case <-healthTicker.C:
 			p.healthCheck(ctx)
 		}
 	}
 }
 
+// SetInterval changes the poll interval of a running poller.
+func (p *EventPoller) SetInterval(d time.Duration) {
+	select {
+	case <-p.interval:
+	default:
+	}
+	p.interval <- d
+}
+
 func (p *EventPoller) registerWithRetry(ctx context.Context) {
 	for {
-		if p.executeScripts() {
+		err := p.executeScripts(ctx)
+		p.tel.Report(ctx, "event_handlers", err)
+		if err == nil {
 			p.registered = true
 			log.Println("RCON event handlers registered")
 			return
 		}
+		log.Printf("event registration failed: %v, retrying in 15s", err)
 		select {
 		case <-ctx.Done():
 			return
@@ -79,38 +102,55 @@ func (p *EventPoller) registerWithRetry(ctx context.Context) {
 	}
 }
 
-func (p *EventPoller) executeScripts() bool {
+func (p *EventPoller) executeScripts(ctx context.Context) error {
+	if p.companion.Available(ctx) {
+		// The companion registers its own handlers at load time.
+		return nil
+	}
 	for i, script := range p.registerScripts {
-		resp, err := p.rcon.Execute("/sc " + script)
-		if err != nil || strings.TrimSpace(resp) != "ok" {
-			log.Printf("event registration failed at script %d (err=%v, resp=%s), retrying in 15s", i+1, err, resp)
-			return false
+		resp, err := p.rcon.Execute(WithRCONKind(ctx, "register"), "/sc "+script)
+		if err != nil {
+			return fmt.Errorf("script %d: %w", i+1, err)
+		}
+		if resp = strings.TrimSpace(resp); resp != "ok" {
+			return fmt.Errorf("script %d: unexpected response %.200q", i+1, resp)
 		}
 	}
-	return true
+	return nil
 }
 
-func (p *EventPoller) poll() {
-	resp, err := p.rcon.Execute("/sc " + p.pollLua)
+func (p *EventPoller) poll(ctx context.Context) {
+	ctx = WithRCONKind(ctx, "poll")
+	resp, err := p.rcon.Execute(ctx, p.companion.Command(ctx, "poll", "", p.pollLua))
 	if err != nil {
 		log.Printf("event poll error: %v", err)
+		p.tel.Report(ctx, "poller", err)
 		p.registered = false
 		return
 	}
 
 	resp = strings.TrimSpace(resp)
 	if resp == "" || resp == "[]" || resp == "{}" {
+		p.tel.Report(ctx, "poller", nil)
 		return
 	}
 
 	var events []RCONEvent
 	if err := json.Unmarshal([]byte(resp), &events); err != nil {
 		log.Printf("event poll parse error: %v (resp=%.200s)", err, resp)
+		p.tel.Report(ctx, "poller", fmt.Errorf("%w: %v", errParse, err))
+		p.companion.Reset()
 		return
 	}
+	p.tel.Report(ctx, "poller", nil)
 
+	// Events of one tick always arrive in the same poll, so their order in
+	// it tells otherwise identical events (two spawners destroyed) apart.
+	perTick := make(map[int64]int)
 	for _, e := range events {
 		ge := e.toGameEvent()
+		ge.seq = perTick[e.Tick]
+		perTick[e.Tick]++
 		for _, sub := range p.subscribers {
 			sub.OnLogEvent(ge)
 		}
@@ -122,9 +162,13 @@ func (p *EventPoller) healthCheck(ctx context.Context) {
 		p.registerWithRetry(ctx)
 		return
 	}
-	resp, err := p.rcon.Execute(`/sc rcon.print(storage.bridge_events ~= nil and "ok" or "missing")`)
+	if p.companion.Available(ctx) {
+		return
+	}
+	resp, err := p.rcon.Execute(WithRCONKind(ctx, "health"), `/sc rcon.print(storage.bridge_events ~= nil and "ok" or "missing")`)
 	if err != nil || strings.TrimSpace(resp) != "ok" {
 		log.Println("event handlers missing, re-registering...")
+		p.tel.Report(ctx, "event_handlers", errors.New("event handlers missing"))
 		p.registered = false
 		p.registerWithRetry(ctx)
 	}
@@ -132,9 +176,12 @@ func (p *EventPoller) healthCheck(ctx context.Context) {
 
 func (e *RCONEvent) toGameEvent() GameEvent {
 	ge := GameEvent{
-		Type:  e.Type,
-		Time:  time.Now(),
-		Extra: make(map[string]string),
+		Type:    e.Type,
+		Source:  SourceRCON,
+		Surface: e.Surface,
+		Tick:    e.Tick,
+		Time:    time.Now(),
+		Extra:   make(map[string]string),
 	}
 	if e.Player != "" {
 		ge.Player = e.Player
@@ -145,9 +192,6 @@ func (e *RCONEvent) toGameEvent() GameEvent {
 	if e.Cause != "" {
 		ge.Extra["cause"] = e.Cause
 	}
-	if e.Surface != "" {
-		ge.Extra["surface"] = e.Surface
-	}
 	if e.State != "" {
 		ge.Extra["state"] = e.State
 	}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventIDSameTick(t *testing.T) {
+	spawner := func(seq int, read time.Time) GameEvent {
+		return GameEvent{Type: "spawner_destroyed", Source: SourceRCON, Tick: 36000, seq: seq,
+			Extra: map[string]string{"name": "biter-spawner"}, Time: read}
+	}
+	t0 := time.Date(2024, 10, 21, 10, 0, 0, 0, time.UTC)
+	if eventID(spawner(0, t0)) == eventID(spawner(1, t0)) {
+		t.Error("two events in one tick got the same ID")
+	}
+	if eventID(spawner(1, t0)) != eventID(spawner(1, t0.Add(time.Minute))) {
+		t.Error("the ID of a tick event depends on when it was read")
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// HealthServer serves /healthz (process alive), /readyz (every required
+// component is ready, see componentStatus.ready) and /status (JSON details
+// per component).
+type HealthServer struct {
+	addr     string
+	tel      *Telemetry
+	required []string
+}
+
+func NewHealthServer(addr string, tel *Telemetry, required []string) *HealthServer {
+	return &HealthServer{addr: addr, tel: tel, required: required}
+}
+
+type componentReport struct {
+	Up          bool       `json:"up"` // last run succeeded
+	Ready       bool       `json:"ready"`
+	Failures    int        `json:"consecutive_failures,omitempty"`
+	Required    bool       `json:"required"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+type statusReport struct {
+	Ready      bool                       `json:"ready"`
+	NotReady   []string                   `json:"not_ready,omitempty"`
+	Components map[string]componentReport `json:"components"`
+}
+
+func (h *HealthServer) status() statusReport {
+	statuses := h.tel.Statuses()
+	now := time.Now()
+	r := statusReport{Components: make(map[string]componentReport, len(statuses))}
+	for name, s := range statuses {
+		c := componentReport{Up: s.up, Ready: s.ready(now), Failures: s.failures, LastError: s.lastError}
+		if !s.lastSuccess.IsZero() {
+			c.LastSuccess = &s.lastSuccess
+		}
+		if !s.lastErrorAt.IsZero() {
+			c.LastErrorAt = &s.lastErrorAt
+		}
+		r.Components[name] = c
+	}
+	for _, name := range h.required {
+		c := r.Components[name] // not reported yet: down
+		c.Required = true
+		r.Components[name] = c
+		if !c.Ready {
+			r.NotReady = append(r.NotReady, name)
+		}
+	}
+	sort.Strings(r.NotReady)
+	r.Ready = len(r.NotReady) == 0
+	return r
+}
+
+func (h *HealthServer) Run(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		r := h.status()
+		if !r.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			for _, name := range r.NotReady {
+				w.Write([]byte(name + ": not ready\n"))
+			}
+			return
+		}
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, _ *http.Request) {
+		r := h.status()
+		w.Header().Set("Content-Type", "application/json")
+		if !r.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(r)
+	})
+
+	srv := &http.Server{Addr: h.addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("health endpoints listening on %s", h.addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("health server: %v", err)
+	}
+}
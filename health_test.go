@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+func TestComponentReady(t *testing.T) {
+	now := time.Date(2024, 10, 21, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		s    componentStatus
+		want bool
+	}{
+		{"never reported", componentStatus{}, false},
+		{"failed before any success", componentStatus{failures: 1, failingFrom: now}, false},
+		{"succeeding", componentStatus{up: true, lastSuccess: now}, true},
+		{"one timeout", componentStatus{lastSuccess: now.Add(-time.Second), failures: 1, failingFrom: now}, true},
+		{"failures in a row", componentStatus{lastSuccess: now.Add(-time.Second), failures: notReadyAfter, failingFrom: now}, false},
+		{"failing for long", componentStatus{lastSuccess: now.Add(-time.Hour), failures: 1, failingFrom: now.Add(-notReadyWindow)}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.s.ready(now); got != tt.want {
+			t.Errorf("%s: ready = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHealthStatusFlap(t *testing.T) {
+	tel, err := NewTelemetry(noop.NewMeterProvider().Meter(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHealthServer("", tel, []string{"rcon"})
+	ctx := context.Background()
+	timeout := errors.New("timeout")
+
+	if h.status().Ready {
+		t.Error("ready before rcon reported")
+	}
+	tel.Report(ctx, "rcon", nil)
+	tel.Report(ctx, "rcon", timeout)
+	if r := h.status(); !r.Ready || r.Components["rcon"].Up {
+		t.Errorf("after one failure: %+v, want ready with rcon not up", r)
+	}
+	tel.Report(ctx, "rcon", nil)
+	for i := 0; i < notReadyAfter; i++ {
+		tel.Report(ctx, "rcon", timeout)
+	}
+	if r := h.status(); r.Ready || r.Components["rcon"].Failures != notReadyAfter {
+		t.Errorf("after %d failures: %+v, want not ready", notReadyAfter, r)
+	}
+	tel.Report(ctx, "rcon", nil)
+	if !h.status().Ready {
+		t.Error("not ready after recovering")
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// JournaldLogSource follows a systemd unit's journal via journalctl.
+// Reconnects resume after the cursor of the last delivered entry.
+type JournaldLogSource struct {
+	unit string
+
+	mu     sync.Mutex
+	cursor string // __CURSOR of the newest delivered entry
+}
+
+func (s *JournaldLogSource) Name() string { return "journald unit " + s.unit }
+
+func (s *JournaldLogSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	args := []string{"--follow", "--output=json", "--output-fields=MESSAGE", "--unit=" + s.unit}
+	s.mu.Lock()
+	if s.cursor == "" {
+		args = append(args, "--lines=0")
+	} else {
+		args = append(args, "--after-cursor="+s.cursor)
+	}
+	s.mu.Unlock()
+
+	cmd := exec.CommandContext(ctx, "journalctl", args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start journalctl: %w", err)
+	}
+	return &journalReader{stdout: stdout, r: bufio.NewReader(stdout), cmd: cmd, src: s}, nil
+}
+
+// journalEntry is one line of journalctl --output=json. MESSAGE is a string,
+// or an array of bytes when it isn't valid UTF-8.
+type journalEntry struct {
+	Cursor   string          `json:"__CURSOR"`
+	Realtime string          `json:"__REALTIME_TIMESTAMP"` // microseconds since the epoch
+	Message  json.RawMessage `json:"MESSAGE"`
+}
+
+// line is the entry as a log line, prefixed with its RFC 3339 timestamp like
+// Kubernetes and Docker lines.
+func (e *journalEntry) line() string {
+	us, err := strconv.ParseInt(e.Realtime, 10, 64)
+	if err != nil {
+		return e.text()
+	}
+	return time.UnixMicro(us).UTC().Format(time.RFC3339Nano) + " " + e.text()
+}
+
+func (e *journalEntry) text() string {
+	var s string
+	if json.Unmarshal(e.Message, &s) == nil {
+		return s
+	}
+	var b []byte
+	var ints []int
+	if json.Unmarshal(e.Message, &ints) == nil {
+		for _, c := range ints {
+			b = append(b, byte(c))
+		}
+	}
+	return string(b)
+}
+
+// journalReader turns journal entries into log lines, records the cursor of
+// each delivered entry and stops journalctl when the stream is closed.
+type journalReader struct {
+	stdout io.ReadCloser
+	r      *bufio.Reader
+	cmd    *exec.Cmd
+	src    *JournaldLogSource
+	buf    []byte
+}
+
+func (r *journalReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		line, err := r.r.ReadBytes('\n')
+		var e journalEntry
+		if len(line) > 0 && json.Unmarshal(line, &e) == nil && e.Cursor != "" {
+			r.buf = append([]byte(e.line()), '\n')
+			r.src.mu.Lock()
+			r.src.cursor = e.Cursor
+			r.src.mu.Unlock()
+		}
+		if err != nil && len(r.buf) == 0 {
+			return 0, err
+		}
+		if err != nil {
+			break
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *journalReader) Close() error {
+	r.cmd.Process.Kill()
+	r.stdout.Close()
+	r.cmd.Wait()
+	return nil
+}
@@ -3,104 +3,303 @@ package main
 import (
 	"context"
 	"crypto/tls"
-	"encoding/json"
+	"crypto/x509"
+	"encoding/base64"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	serviceAccountDir    = "/var/run/secrets/kubernetes.io/serviceaccount"
+	tokenRefreshInterval = time.Minute
 )
 
-// K8sClient provides in-cluster Kubernetes API access.
+// K8sClient provides Kubernetes API access, either in-cluster via the
+// service account or out-of-cluster via a kubeconfig file.
 type K8sClient struct {
 	namespace string
+	server    string
+	client    *http.Client
+
+	staticToken string // token from kubeconfig
+	tokenFile   string // re-read periodically to pick up rotated tokens
+
+	mu          sync.Mutex
+	token       string
+	tokenReadAt time.Time
 }
 
-func NewK8sClient(namespace string) *K8sClient {
-	return &K8sClient{namespace: namespace}
+// NewK8sClient creates a client from kubeconfigPath, or from the in-cluster
+// service account when kubeconfigPath is empty. Outside a cluster it falls
+// back to $KUBECONFIG and ~/.kube/config.
+func NewK8sClient(namespace, kubeconfigPath string) (*K8sClient, error) {
+	if kubeconfigPath == "" && os.Getenv("KUBERNETES_SERVICE_HOST") == "" {
+		kubeconfigPath = os.Getenv("KUBECONFIG")
+		if kubeconfigPath == "" {
+			if home, err := os.UserHomeDir(); err == nil {
+				kubeconfigPath = filepath.Join(home, ".kube", "config")
+			}
+		}
+	}
+	if kubeconfigPath != "" {
+		return newK8sClientFromKubeconfig(namespace, kubeconfigPath)
+	}
+	return newInClusterK8sClient(namespace)
 }
 
-func (k *K8sClient) FindPod(ctx context.Context, labelSelector string) (string, error) {
-	client, token, err := k.httpClient()
+func newInClusterK8sClient(namespace string) (*K8sClient, error) {
+	ca, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("read sa ca: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates in %s/ca.crt", serviceAccountDir)
 	}
 
-	url := fmt.Sprintf("%s/api/v1/namespaces/%s/pods?labelSelector=%s&limit=1",
-		k.apiBase(), k.namespace, labelSelector)
+	k := &K8sClient{
+		namespace: namespace,
+		server:    inClusterServer(),
+		client:    newK8sHTTPClient(&tls.Config{RootCAs: pool}),
+		tokenFile: filepath.Join(serviceAccountDir, "token"),
+	}
+	if _, err := k.bearerToken(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
 
-	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
-	req.Header.Set("Authorization", "Bearer "+token)
+func inClusterServer() string {
+	host := os.Getenv("KUBERNETES_SERVICE_HOST")
+	port := os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return "https://kubernetes.default.svc"
+	}
+	return "https://" + strings.TrimSuffix(host, "/") + ":" + port
+}
 
-	resp, err := client.Do(req)
+// kubeconfig is the subset of the kubeconfig format needed for token and
+// client certificate auth. Exec and auth-provider plugins are not supported.
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+			TLSServerName            string `yaml:"tls-server-name"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string     `yaml:"token"`
+			TokenFile             string     `yaml:"tokenFile"`
+			ClientCertificate     string     `yaml:"client-certificate"`
+			ClientCertificateData string     `yaml:"client-certificate-data"`
+			ClientKey             string     `yaml:"client-key"`
+			ClientKeyData         string     `yaml:"client-key-data"`
+			Exec                  *yaml.Node `yaml:"exec"`
+			AuthProvider          *yaml.Node `yaml:"auth-provider"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+}
+
+func newK8sClientFromKubeconfig(namespace, path string) (*K8sClient, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("read kubeconfig: %w", err)
+	}
+	var kc kubeconfig
+	if err := yaml.Unmarshal(data, &kc); err != nil {
+		return nil, fmt.Errorf("parse kubeconfig %s: %w", path, err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("list pods: %s %s", resp.Status, string(body))
+	var clusterName, userName string
+	for _, c := range kc.Contexts {
+		if c.Name == kc.CurrentContext {
+			clusterName, userName = c.Context.Cluster, c.Context.User
+		}
+	}
+	if clusterName == "" {
+		return nil, fmt.Errorf("kubeconfig %s: current context %q not found", path, kc.CurrentContext)
 	}
 
-	var result struct {
-		Items []struct {
-			Metadata struct {
-				Name string `json:"name"`
-			} `json:"metadata"`
-		} `json:"items"`
+	dir := filepath.Dir(path)
+	tlsConfig := &tls.Config{}
+	k := &K8sClient{namespace: namespace}
+
+	found := false
+	for _, c := range kc.Clusters {
+		if c.Name != clusterName {
+			continue
+		}
+		found = true
+		k.server = strings.TrimSuffix(c.Cluster.Server, "/")
+		tlsConfig.InsecureSkipVerify = c.Cluster.InsecureSkipTLSVerify
+		tlsConfig.ServerName = c.Cluster.TLSServerName
+		ca, err := kubeconfigData(dir, c.Cluster.CertificateAuthority, c.Cluster.CertificateAuthorityData)
+		if err != nil {
+			return nil, fmt.Errorf("kubeconfig cluster %s ca: %w", clusterName, err)
+		}
+		if ca != nil {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(ca) {
+				return nil, fmt.Errorf("kubeconfig cluster %s: no certificates in ca", clusterName)
+			}
+			tlsConfig.RootCAs = pool
+		}
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
+	if !found {
+		return nil, fmt.Errorf("kubeconfig %s: cluster %q not found", path, clusterName)
 	}
-	if len(result.Items) == 0 {
-		return "", fmt.Errorf("no pods found with label %s", labelSelector)
+
+	for _, u := range kc.Users {
+		if u.Name != userName {
+			continue
+		}
+		if u.User.Exec != nil || u.User.AuthProvider != nil {
+			return nil, fmt.Errorf("kubeconfig user %s: exec and auth-provider plugins are not supported", userName)
+		}
+		k.staticToken = u.User.Token
+		if u.User.TokenFile != "" {
+			k.tokenFile = resolvePath(dir, u.User.TokenFile)
+		}
+		cert, err := kubeconfigData(dir, u.User.ClientCertificate, u.User.ClientCertificateData)
+		if err != nil {
+			return nil, fmt.Errorf("kubeconfig user %s certificate: %w", userName, err)
+		}
+		key, err := kubeconfigData(dir, u.User.ClientKey, u.User.ClientKeyData)
+		if err != nil {
+			return nil, fmt.Errorf("kubeconfig user %s key: %w", userName, err)
+		}
+		if cert != nil || key != nil {
+			pair, err := tls.X509KeyPair(cert, key)
+			if err != nil {
+				return nil, fmt.Errorf("kubeconfig user %s client certificate: %w", userName, err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{pair}
+		}
 	}
-	return result.Items[0].Metadata.Name, nil
+
+	k.client = newK8sHTTPClient(tlsConfig)
+	return k, nil
 }
 
-func (k *K8sClient) StreamLogs(ctx context.Context, podName string) (io.ReadCloser, error) {
-	client, token, err := k.httpClient()
-	if err != nil {
-		return nil, err
+// kubeconfigData returns inline base64 data, or the contents of file
+// (relative to the kubeconfig directory). It returns nil if neither is set.
+func kubeconfigData(dir, file, data string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if file != "" {
+		return os.ReadFile(resolvePath(dir, file))
 	}
+	return nil, nil
+}
 
-	url := fmt.Sprintf("%s/api/v1/namespaces/%s/pods/%s/log?follow=true&sinceSeconds=10&timestamps=false",
-		k.apiBase(), k.namespace, podName)
+func resolvePath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
 
-	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
-	req.Header.Set("Authorization", "Bearer "+token)
-	client.Timeout = 0
+func newK8sHTTPClient(tlsConfig *tls.Config) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	// No client timeout: log streams are long-lived. Requests use ctx instead.
+	return &http.Client{Transport: transport}
+}
 
-	resp, err := client.Do(req)
+// bearerToken returns the current token, re-reading the token file at most
+// once per tokenRefreshInterval so rotated service account tokens are used.
+func (k *K8sClient) bearerToken() (string, error) {
+	if k.tokenFile == "" {
+		return k.staticToken, nil
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.token != "" && time.Since(k.tokenReadAt) < tokenRefreshInterval {
+		return k.token, nil
+	}
+	data, err := os.ReadFile(k.tokenFile)
 	if err != nil {
-		return nil, err
+		if k.token != "" {
+			// Keep using the last token; the file may be mid-rotation.
+			return k.token, nil
+		}
+		return "", fmt.Errorf("read token: %w", err)
 	}
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		return nil, fmt.Errorf("stream logs: %s %s", resp.Status, string(body))
+	k.token = strings.TrimSpace(string(data))
+	k.tokenReadAt = time.Now()
+	return k.token, nil
+}
+
+// get performs an authenticated GET against the API server and returns the
+// response if its status is 200 OK.
+func (k *K8sClient) get(ctx context.Context, path string) (*http.Response, error) {
+	token, err := k.bearerToken()
+	if err != nil {
+		return nil, err
 	}
 
-	return resp.Body, nil
-}
+	req, err := http.NewRequestWithContext(ctx, "GET", k.server+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
 
-func (k *K8sClient) httpClient() (*http.Client, string, error) {
-	token, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/token")
+	resp, err := k.client.Do(req)
 	if err != nil {
-		return nil, "", fmt.Errorf("read sa token: %w", err)
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusUnauthorized {
+			// Force a token re-read on the next request.
+			k.mu.Lock()
+			k.tokenReadAt = time.Time{}
+			k.mu.Unlock()
+		}
+		return nil, fmt.Errorf("%s %s", resp.Status, string(body))
 	}
-	return &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
-	}, string(token), nil
+	return resp, nil
 }
 
-func (k *K8sClient) apiBase() string {
-	host := os.Getenv("KUBERNETES_SERVICE_HOST")
-	port := os.Getenv("KUBERNETES_SERVICE_PORT")
-	if host == "" || port == "" {
-		return "https://kubernetes.default.svc"
+// StreamLogs follows a pod's logs. query holds extra log options such as
+// sinceTime, tailLines or timestamps.
+func (k *K8sClient) StreamLogs(ctx context.Context, podName string, query url.Values) (io.ReadCloser, error) {
+	q := url.Values{"follow": {"true"}}
+	for key, v := range query {
+		q[key] = v
 	}
-	return fmt.Sprintf("https://%s:%s", host, port)
+	resp, err := k.get(ctx, fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/log?%s",
+		k.namespace, url.PathEscape(podName), q.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("stream logs: %w", err)
+	}
+	return resp.Body, nil
 }
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	versionPattern = regexp.MustCompile(`Factorio (\d+\.\d+\.\d+) \(build (\d+)`)
+	modLoadPattern = regexp.MustCompile(`Loading mod (\S+) (\S+) \(data\.lua\)`)
+	mapLoadPattern = regexp.MustCompile(`Loading map (.+?): \d+ bytes`)
+	hostingPattern = regexp.MustCompile(`Hosting game at IP ADDR:\(\{?([^})]+)\}?\)`)
+	inGamePattern  = regexp.MustCompile(`changing state from\((\w+)\) to\(InGame\)`)
+	quitPattern    = regexp.MustCompile(`Quitting:\s+(.+?)\.?$`)
+	goodbyePattern = regexp.MustCompile(`\bGoodbye\b`)
+	desyncPattern  = regexp.MustCompile(`(?i)desynchroni[sz]ation|\bdesync(?:ed)?\b`)
+	peerPattern    = regexp.MustCompile(`peer\((\d+)\)`)
+	signalPattern  = regexp.MustCompile(`Received (SIG[A-Z]+)`)
+	crashPattern   = regexp.MustCompile(`Received SIG[A-Z]+|Factorio crashed`)
+	errorPattern   = regexp.MustCompile(`^\s*\d+\.\d+ Error (.+)`)
+)
+
+// lifecycleParser recognizes server startup, shutdown, crash and desync
+// lines. It keeps state across lines (version, mod count, whether the server
+// is up) so the "server started" event can summarize the boot.
+type lifecycleParser struct {
+	version string
+	build   string
+	mods    int
+	mapName string
+	address string
+	up      bool
+}
+
+func (p *lifecycleParser) parse(line string, now time.Time) *GameEvent {
+	event := func(typ string, extra map[string]string) *GameEvent {
+		return &GameEvent{Type: typ, Extra: extra, Time: now}
+	}
+
+	if m := versionPattern.FindStringSubmatch(line); m != nil {
+		*p = lifecycleParser{version: m[1], build: m[2]}
+		return event("server_starting", map[string]string{"version": m[1], "build": m[2]})
+	}
+	if modLoadPattern.MatchString(line) {
+		p.mods++
+		return nil
+	}
+	if m := mapLoadPattern.FindStringSubmatch(line); m != nil {
+		p.mapName = path.Base(m[1])
+		return event("server_loading", map[string]string{"map": p.mapName})
+	}
+	if m := hostingPattern.FindStringSubmatch(line); m != nil {
+		p.address = m[1]
+		return nil
+	}
+	if m := inGamePattern.FindStringSubmatch(line); m != nil {
+		// Saving the map also ends in InGame (from InGameSavingMap); only a
+		// boot we saw from its version line counts as a start.
+		if p.up || p.version == "" || strings.HasPrefix(m[1], "InGame") {
+			return nil
+		}
+		p.up = true
+		return event("server_started", map[string]string{
+			"version": p.version,
+			"build":   p.build,
+			"mods":    strconv.Itoa(p.mods),
+			"map":     p.mapName,
+			"address": p.address,
+		})
+	}
+	if m := quitPattern.FindStringSubmatch(line); m != nil && p.up {
+		p.up = false
+		return event("server_stopped", map[string]string{"reason": m[1]})
+	}
+	if goodbyePattern.MatchString(line) && p.up {
+		p.up = false
+		return event("server_stopped", map[string]string{"reason": "goodbye"})
+	}
+	if m := signalPattern.FindStringSubmatch(line); m != nil && (m[1] == "SIGTERM" || m[1] == "SIGINT") {
+		// A normal shutdown request, e.g. from docker stop or systemd.
+		p.up = false
+		return event("server_stopped", map[string]string{"reason": m[1]})
+	}
+	if crashPattern.MatchString(line) {
+		p.up = false
+		return event("server_crashed", map[string]string{"reason": strings.TrimSpace(crashPattern.FindString(line)), "message": trimLogPrefix(line)})
+	}
+	if desyncPattern.MatchString(line) {
+		extra := map[string]string{"message": trimLogPrefix(line)}
+		if m := peerPattern.FindStringSubmatch(line); m != nil {
+			extra["peer"] = m[1]
+		}
+		return event("desync", extra)
+	}
+	if m := errorPattern.FindStringSubmatch(line); m != nil {
+		return event("server_error", map[string]string{"message": m[1]})
+	}
+	return nil
+}
+
+// trimLogPrefix removes the "  12.345 " uptime prefix of Factorio log lines.
+func trimLogPrefix(line string) string {
+	line = strings.TrimSpace(line)
+	if i := strings.IndexByte(line, ' '); i > 0 {
+		if _, err := strconv.ParseFloat(line[:i], 64); err == nil {
+			return strings.TrimSpace(line[i:])
+		}
+	}
+	return line
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// lifecycleEvents parses lines with a fresh parser and returns the events.
+func lifecycleEvents(lines []string) []GameEvent {
+	var p lifecycleParser
+	var events []GameEvent
+	for _, line := range lines {
+		if e := p.parse(line, time.Time{}); e != nil {
+			events = append(events, *e)
+		}
+	}
+	return events
+}
+
+const (
+	bootVersion = "   0.000 2024-10-21 10:00:00; Factorio 2.0.15 (build 79590, linux64, headless)"
+	bootMod1    = "   0.512 Loading mod core 0.0.0 (data.lua)"
+	bootMod2    = "   0.600 Loading mod base 2.0.15 (data.lua)"
+	bootMap     = "   1.700 Loading map /factorio/saves/world.zip: 12345678 bytes."
+	bootHost    = "   2.000 Hosting game at IP ADDR:({0.0.0.0:34197})"
+	bootInGame  = "   2.100 Info ServerMultiplayerManager.cpp:807: updateTick(4294967295) changing state from(CreatingGame) to(InGame)"
+	saveStart   = " 300.000 Info ServerMultiplayerManager.cpp:807: updateTick(18000) changing state from(InGame) to(InGameSavingMap)"
+	saveEnd     = " 301.000 Info ServerMultiplayerManager.cpp:807: updateTick(18060) changing state from(InGameSavingMap) to(InGame)"
+)
+
+func TestLifecycleBoot(t *testing.T) {
+	events := lifecycleEvents([]string{bootVersion, bootMod1, bootMod2, bootMap, bootHost, bootInGame, saveStart, saveEnd})
+	want := []GameEvent{
+		{Type: "server_starting", Extra: map[string]string{"version": "2.0.15", "build": "79590"}},
+		{Type: "server_loading", Extra: map[string]string{"map": "world.zip"}},
+		{Type: "server_started", Extra: map[string]string{
+			"version": "2.0.15", "build": "79590", "mods": "2", "map": "world.zip", "address": "0.0.0.0:34197"}},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("got %+v\nwant %+v", events, want)
+	}
+}
+
+func TestLifecycleAutosaveAfterRestart(t *testing.T) {
+	// The exporter started while the server was running: it never saw the
+	// boot, so returning from an autosave is not a start.
+	if events := lifecycleEvents([]string{saveStart, saveEnd}); len(events) != 0 {
+		t.Errorf("got %+v, want no events", events)
+	}
+}
+
+func TestLifecycleStop(t *testing.T) {
+	boot := []string{bootVersion, bootMap, bootInGame}
+	tests := []struct {
+		name  string
+		lines []string
+		want  []string // types after the boot events
+		extra map[string]string
+	}{
+		{"quit", []string{" 500.000 Quitting: remote-quit.", " 500.100 Goodbye"},
+			[]string{"server_stopped"}, map[string]string{"reason": "remote-quit"}},
+		{"SIGTERM", []string{" 500.000 Received SIGTERM, shutting down", " 500.010 Quitting: multiplayer connection.", " 500.100 Goodbye"},
+			[]string{"server_stopped"}, map[string]string{"reason": "SIGTERM"}},
+		{"SIGINT", []string{" 500.000 Received SIGINT, shutting down"},
+			[]string{"server_stopped"}, map[string]string{"reason": "SIGINT"}},
+		{"goodbye only", []string{" 500.100 Goodbye"},
+			[]string{"server_stopped"}, map[string]string{"reason": "goodbye"}},
+		{"SIGSEGV", []string{" 500.000 Received SIGSEGV"},
+			[]string{"server_crashed"}, map[string]string{"reason": "Received SIGSEGV", "message": "Received SIGSEGV"}},
+		{"crash", []string{" 500.000 Factorio crashed. Generating symbolized stacktrace, please wait ..."},
+			[]string{"server_crashed"}, map[string]string{"reason": "Factorio crashed", "message": "Factorio crashed. Generating symbolized stacktrace, please wait ..."}},
+	}
+	for _, tt := range tests {
+		events := lifecycleEvents(append(append([]string(nil), boot...), tt.lines...))[3:]
+		var types []string
+		for _, e := range events {
+			types = append(types, e.Type)
+		}
+		if !reflect.DeepEqual(types, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, types, tt.want)
+			continue
+		}
+		if !reflect.DeepEqual(events[0].Extra, tt.extra) {
+			t.Errorf("%s: got extra %v, want %v", tt.name, events[0].Extra, tt.extra)
+		}
+	}
+}
+
+func TestLifecycleDesyncAndErrors(t *testing.T) {
+	events := lifecycleEvents([]string{
+		" 120.000 Info ServerMultiplayerManager.cpp:1051: Player desynced: peer(3)",
+		" 121.000 Error ServerMultiplayerManager.cpp:112: MultiplayerManager failed: \"Map version mismatch\"",
+	})
+	want := []GameEvent{
+		{Type: "desync", Extra: map[string]string{"message": "Info ServerMultiplayerManager.cpp:1051: Player desynced: peer(3)", "peer": "3"}},
+		{Type: "server_error", Extra: map[string]string{"message": "ServerMultiplayerManager.cpp:112: MultiplayerManager failed: \"Map version mismatch\""}},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("got %+v\nwant %+v", events, want)
+	}
+}
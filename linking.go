@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// codeAlphabet avoids look-alike characters (0/O, 1/I/L).
+const codeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+var errInvalidCode = errors.New("unknown or expired code")
+
+// AccountLink maps a chat platform user to a Factorio player.
+type AccountLink struct {
+	DiscordID   string    `json:"discord_id"`
+	DiscordName string    `json:"discord_name"`
+	Player      string    `json:"player"`
+	LinkedAt    time.Time `json:"linked_at"`
+}
+
+type pendingLink struct {
+	player  string
+	expires time.Time
+}
+
+// AccountLinker links Discord users to Factorio players. A player runs
+// /link-discord in game, receives a one-time code and redeems it with the
+// /link Discord slash command. Links are persisted as JSON.
+type AccountLinker struct {
+	enabled bool
+	path    string
+	ttl     time.Duration
+
+	mu      sync.Mutex
+	links   map[string]AccountLink // Discord user ID -> link
+	pending map[string]pendingLink // code -> player
+}
+
+func NewAccountLinker(cfg LinkingConfig) (*AccountLinker, error) {
+	l := &AccountLinker{
+		enabled: cfg.Enabled,
+		path:    cfg.Path,
+		ttl:     cfg.CodeTTL,
+		links:   make(map[string]AccountLink),
+		pending: make(map[string]pendingLink),
+	}
+	if !cfg.Enabled {
+		return l, nil
+	}
+
+	data, err := os.ReadFile(cfg.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read links: %w", err)
+	}
+	var links []AccountLink
+	if err := json.Unmarshal(data, &links); err != nil {
+		return nil, fmt.Errorf("parse links %s: %w", cfg.Path, err)
+	}
+	for _, link := range links {
+		l.links[link.DiscordID] = link
+	}
+	log.Printf("loaded %d account links", len(links))
+	return l, nil
+}
+
+func (l *AccountLinker) Enabled() bool { return l.enabled }
+
+// NewCode creates a one-time link code for a player, replacing any earlier
+// code for the same player.
+func (l *AccountLinker) NewCode(player string) (string, error) {
+	buf := make([]byte, 6)
+	n := big.NewInt(int64(len(codeAlphabet)))
+	for i := range buf {
+		// rand.Int is uniform; a byte modulo the alphabet length is not.
+		v, err := rand.Int(rand.Reader, n)
+		if err != nil {
+			return "", err
+		}
+		buf[i] = codeAlphabet[v.Int64()]
+	}
+	code := string(buf)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	for c, p := range l.pending {
+		if p.player == player || now.After(p.expires) {
+			delete(l.pending, c)
+		}
+	}
+	l.pending[code] = pendingLink{player: player, expires: now.Add(l.ttl)}
+	return code, nil
+}
+
+// Redeem links a Discord user to the player that generated code.
+func (l *AccountLinker) Redeem(code, discordID, discordName string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	p, ok := l.pending[code]
+	if !ok || time.Now().After(p.expires) {
+		delete(l.pending, code)
+		return "", errInvalidCode
+	}
+	delete(l.pending, code)
+
+	// One Discord account per player: drop any previous link for the player.
+	for id, link := range l.links {
+		if link.Player == p.player {
+			delete(l.links, id)
+		}
+	}
+	l.links[discordID] = AccountLink{
+		DiscordID:   discordID,
+		DiscordName: discordName,
+		Player:      p.player,
+		LinkedAt:    time.Now(),
+	}
+	return p.player, l.save()
+}
+
+// Unlink removes the link for a Discord user. It returns the unlinked player.
+func (l *AccountLinker) Unlink(discordID string) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	link, ok := l.links[discordID]
+	if !ok {
+		return "", nil
+	}
+	delete(l.links, discordID)
+	return link.Player, l.save()
+}
+
+// PlayerFor returns the Factorio player linked to a Discord user.
+func (l *AccountLinker) PlayerFor(discordID string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	link, ok := l.links[discordID]
+	return link.Player, ok
+}
+
+// DiscordFor returns the Discord user linked to a Factorio player.
+func (l *AccountLinker) DiscordFor(player string) (AccountLink, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, link := range l.links {
+		if link.Player == player {
+			return link, true
+		}
+	}
+	return AccountLink{}, false
+}
+
+// save writes links atomically. Callers must hold l.mu.
+func (l *AccountLinker) save() error {
+	links := make([]AccountLink, 0, len(l.links))
+	for _, link := range l.links {
+		links = append(links, link)
+	}
+	data, err := json.MarshalIndent(links, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return fmt.Errorf("save links: %w", err)
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("save links: %w", err)
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		return fmt.Errorf("save links: %w", err)
+	}
+	return nil
+}
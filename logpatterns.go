@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// consolePrefix matches the optional timestamp Factorio puts in front of
+// console log lines, e.g. "2024-10-21 10:00:00 [CHAT] alice: hi".
+const consolePrefix = `^(?:\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2} )?`
+
+// uptimePrefix matches the seconds-since-start prefix of other log lines,
+// followed by the source of script output, e.g.
+// "  12.345 Script @__level__/control.lua:42: Research finished: automation".
+const uptimePrefix = `^\s*\d+\.\d+ (?:Script @\S+: )?`
+
+// defaultLogPatterns are the built-in line patterns, tried in order. Named
+// capture groups map to GameEvent fields: "player" to Player, "message" to
+// Message and any other name to Extra. Console lines ([CHAT], [JOIN], ...)
+// come first, so chat text that mimics other lines never matches them.
+var defaultLogPatterns = []LogPatternConfig{
+	{Type: "chat", Pattern: consolePrefix + `\[CHAT\] (?P<player>[^:]+): (?P<message>.*)$`},
+	{Type: "join", Pattern: consolePrefix + `\[JOIN\] (?P<player>\S+) joined the game$`},
+	{Type: "leave", Pattern: consolePrefix + `\[LEAVE\] (?P<player>\S+) left the game$`},
+	// Moderation: player is the target, actor who did it.
+	{Type: "kick", Pattern: consolePrefix + `\[KICK\] (?P<player>\S+)(?: \(not on map\))? was kicked by (?P<actor>.+?)\.(?: Reason: (?P<reason>.*?)\.?)?$`},
+	{Type: "ban", Pattern: consolePrefix + `\[BAN\] (?P<player>\S+)(?: \(not on map\))? was banned by (?P<actor>.+?)\.(?: Reason: (?P<reason>.*?)\.?)?$`},
+	{Type: "unban", Pattern: consolePrefix + `\[UNBANNED\] (?P<player>\S+) was unbanned by (?P<actor>.+?)\.$`},
+	{Type: "promote", Pattern: consolePrefix + `\[PROMOTE\] (?P<player>\S+) was promoted to admin by (?P<actor>.+?)\.$`},
+	{Type: "demote", Pattern: consolePrefix + `\[DEMOTE\] (?P<player>\S+) was demoted from admin by (?P<actor>.+?)\.$`},
+	{Type: "command", Pattern: consolePrefix + `\[COMMAND\] (?P<actor>\S+) \(command\): (?P<command>.*)$`},
+	{Type: "research", Pattern: uptimePrefix + `Research finished:\s+(?P<name>.+)$`},
+	{Type: "rocket", Pattern: uptimePrefix + `Rocket launched`},
+	{Type: "save", Pattern: uptimePrefix + `Saving game as\s+(?P<name>.+)$`},
+}
+
+// LogPatternConfig configures a log line pattern. A pattern with the type of
+// a built-in replaces it (an empty pattern disables it); other types are
+// added after the built-ins.
+type LogPatternConfig struct {
+	Type    string `yaml:"type"`
+	Pattern string `yaml:"pattern"`
+}
+
+type logPattern struct {
+	eventType string
+	re        *regexp.Regexp
+}
+
+// compileLogPatterns merges configured patterns into the built-in defaults.
+func compileLogPatterns(configured []LogPatternConfig) ([]logPattern, error) {
+	merged := append([]LogPatternConfig(nil), defaultLogPatterns...)
+	for _, c := range configured {
+		replaced := false
+		for i := range merged {
+			if merged[i].Type == c.Type {
+				merged[i] = c
+				replaced = true
+			}
+		}
+		if !replaced {
+			merged = append(merged, c)
+		}
+	}
+
+	var patterns []logPattern
+	for _, c := range merged {
+		if c.Pattern == "" {
+			continue
+		}
+		if c.Type == "" {
+			return nil, fmt.Errorf("log pattern %q: type is required", c.Pattern)
+		}
+		re, err := regexp.Compile(c.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("log pattern %s: %w", c.Type, err)
+		}
+		patterns = append(patterns, logPattern{eventType: c.Type, re: re})
+	}
+	return patterns, nil
+}
+
+// match returns the event for line, or nil if the pattern doesn't match.
+func (p *logPattern) match(line string, now time.Time) *GameEvent {
+	m := p.re.FindStringSubmatch(line)
+	if m == nil {
+		return nil
+	}
+	event := &GameEvent{Type: p.eventType, Time: now}
+	for i, name := range p.re.SubexpNames() {
+		switch name {
+		case "":
+		case "player":
+			event.Player = m[i]
+		case "message":
+			event.Message = m[i]
+		default:
+			if m[i] == "" {
+				// Optional group that didn't participate.
+				continue
+			}
+			if event.Extra == nil {
+				event.Extra = make(map[string]string)
+			}
+			event.Extra[name] = m[i]
+		}
+	}
+	return event
+}
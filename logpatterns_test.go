@@ -0,0 +1,152 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+type recordingSubscriber struct {
+	events []GameEvent
+}
+
+func (s *recordingSubscriber) OnLogEvent(event GameEvent) {
+	s.events = append(s.events, event)
+}
+
+// TestDefaultLogPatterns feeds log lines as the server writes them through the
+// tailer and checks the exact event each one produces.
+func TestDefaultLogPatterns(t *testing.T) {
+	patterns, err := compileLogPatterns(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type want struct {
+		typ, player, message string
+		extra                map[string]string
+	}
+	tests := []struct {
+		line string
+		want *want
+	}{
+		// Chat that imitates other console lines stays chat.
+		{"2024-10-21 10:00:00 [CHAT] bob: alice joined the game",
+			&want{typ: "chat", player: "bob", message: "alice joined the game"}},
+		{"2024-10-21 10:00:00 [CHAT] bob: [JOIN] alice joined the game",
+			&want{typ: "chat", player: "bob", message: "[JOIN] alice joined the game"}},
+		{"[CHAT] bob: [BAN] alice was banned by carol. Reason: x.",
+			&want{typ: "chat", player: "bob", message: "[BAN] alice was banned by carol. Reason: x."}},
+		{"[CHAT] bob: Research finished: nuclear-power",
+			&want{typ: "chat", player: "bob", message: "Research finished: nuclear-power"}},
+		{"[CHAT] <server>: restarting in 5 minutes",
+			&want{typ: "chat", player: "<server>", message: "restarting in 5 minutes"}},
+
+		// Join and leave, with and without the date prefix.
+		{"2024-10-21 10:00:00 [JOIN] alice joined the game", &want{typ: "join", player: "alice"}},
+		{"[JOIN] alice joined the game", &want{typ: "join", player: "alice"}},
+		{"2024-10-21 10:30:00 [LEAVE] alice left the game", &want{typ: "leave", player: "alice"}},
+		{"[LEAVE] alice left the game", &want{typ: "leave", player: "alice"}},
+		{"[JOIN] alice joined the game, said bob", nil},
+
+		// Moderation.
+		{"2024-10-21 11:00:00 [KICK] mallory was kicked by alice. Reason: spamming.",
+			&want{typ: "kick", player: "mallory", extra: map[string]string{"actor": "alice", "reason": "spamming"}}},
+		{"[KICK] mallory was kicked by alice.",
+			&want{typ: "kick", player: "mallory", extra: map[string]string{"actor": "alice"}}},
+		{"[KICK] mallory (not on map) was kicked by <server>. Reason: afk.",
+			&want{typ: "kick", player: "mallory", extra: map[string]string{"actor": "<server>", "reason": "afk"}}},
+		{"2024-10-21 11:05:00 [BAN] mallory was banned by alice. Reason: griefing.",
+			&want{typ: "ban", player: "mallory", extra: map[string]string{"actor": "alice", "reason": "griefing"}}},
+		{"[BAN] mallory (not on map) was banned by alice.",
+			&want{typ: "ban", player: "mallory", extra: map[string]string{"actor": "alice"}}},
+		{"2024-10-22 09:00:00 [UNBANNED] mallory was unbanned by alice.",
+			&want{typ: "unban", player: "mallory", extra: map[string]string{"actor": "alice"}}},
+		{"[PROMOTE] bob was promoted to admin by alice.",
+			&want{typ: "promote", player: "bob", extra: map[string]string{"actor": "alice"}}},
+		{"2024-10-21 12:00:00 [DEMOTE] bob was demoted from admin by alice.",
+			&want{typ: "demote", player: "bob", extra: map[string]string{"actor": "alice"}}},
+		{`2024-10-21 12:10:00 [COMMAND] alice (command): /c game.print("hi: there")`,
+			&want{typ: "command", extra: map[string]string{"actor": "alice", "command": `/c game.print("hi: there")`}}},
+		// The exporter's own RCON commands are dropped.
+		{"2024-10-21 12:10:00 [COMMAND] <server> (command): /sc rcon.print(game.tick)", nil},
+
+		// Server and script lines with the uptime prefix.
+		{"  1234.567 Script @__level__/control.lua:42: Research finished: automation",
+			&want{typ: "research", extra: map[string]string{"name": "automation"}}},
+		{"  1234.567 Research finished: logistics-2",
+			&want{typ: "research", extra: map[string]string{"name": "logistics-2"}}},
+		{"  5000.000 Script @__level__/control.lua:60: Rocket launched",
+			&want{typ: "rocket"}},
+		{"   600.016 Saving game as /factorio/saves/_autosave1.zip",
+			&want{typ: "save", extra: map[string]string{"name": "/factorio/saves/_autosave1.zip"}}},
+		// The same words anywhere else are not events.
+		{"2024-10-21 12:20:00 [CHAT] bob: Rocket launched", &want{typ: "chat", player: "bob", message: "Rocket launched"}},
+		{"2024-10-21 12:20:00 [CHAT] bob: Saving game as bob.zip", &want{typ: "chat", player: "bob", message: "Saving game as bob.zip"}},
+		{"2024-10-21 12:20:00 [WHISPER] bob: Research finished: fake", nil},
+		{"  12.000 Info Something: Rocket launched", nil},
+	}
+
+	for _, tt := range tests {
+		sub := &recordingSubscriber{}
+		tailer := NewLogTailer(nil, patterns, nil)
+		tailer.Subscribe(sub)
+		tailer.parseLine(tt.line)
+
+		if tt.want == nil {
+			if len(sub.events) != 0 {
+				t.Errorf("%q: got %+v, want no event", tt.line, sub.events)
+			}
+			continue
+		}
+		if len(sub.events) != 1 {
+			t.Errorf("%q: got %d events, want 1", tt.line, len(sub.events))
+			continue
+		}
+		e := sub.events[0]
+		if e.Type != tt.want.typ || e.Player != tt.want.player || e.Message != tt.want.message {
+			t.Errorf("%q: got type=%q player=%q message=%q, want type=%q player=%q message=%q",
+				tt.line, e.Type, e.Player, e.Message, tt.want.typ, tt.want.player, tt.want.message)
+		}
+		if !reflect.DeepEqual(e.Extra, tt.want.extra) {
+			t.Errorf("%q: got extra %v, want %v", tt.line, e.Extra, tt.want.extra)
+		}
+		if e.Source != SourceLog {
+			t.Errorf("%q: got source %q, want %q", tt.line, e.Source, SourceLog)
+		}
+	}
+}
+
+// TestLogEventID checks that log events are identified by their line: the
+// stream timestamp is trimmed before matching, and identical chat at
+// different times gets different IDs while a re-read line keeps its ID.
+func TestLogEventID(t *testing.T) {
+	patterns, err := compileLogPatterns(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := &recordingSubscriber{}
+	tailer := NewLogTailer(nil, patterns, nil)
+	tailer.Subscribe(sub)
+	for _, line := range []string{
+		"2024-10-21T10:00:00.000000001Z 2024-10-21 10:00:00 [CHAT] bob: gg",
+		"2024-10-21T10:00:00.500000000Z 2024-10-21 10:00:00 [CHAT] bob: gg",
+		"2024-10-21T10:00:00.000000001Z 2024-10-21 10:00:00 [CHAT] bob: gg",
+	} {
+		tailer.parseLine(line)
+	}
+	if len(sub.events) != 3 {
+		t.Fatalf("got %d events, want 3", len(sub.events))
+	}
+	for _, e := range sub.events {
+		if e.Type != "chat" || e.Player != "bob" || e.Message != "gg" {
+			t.Errorf("got %+v, want chat from bob", e)
+		}
+	}
+	first, second, again := eventID(sub.events[0]), eventID(sub.events[1]), eventID(sub.events[2])
+	if first == second {
+		t.Error("identical chat at different times got the same ID")
+	}
+	if first != again {
+		t.Error("the same line got different IDs")
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	LogSourceKubernetes = "kubernetes"
+	LogSourceFile       = "file"
+	LogSourceDocker     = "docker"
+	LogSourceJournald   = "journald"
+
+	filePollInterval = 500 * time.Millisecond
+)
+
+// LogSource opens a stream of Factorio server log lines.
+type LogSource interface {
+	// Name describes where the logs come from, e.g. "pod factorio/server-0".
+	Name() string
+	// Open follows the log until ctx is cancelled or the stream breaks.
+	// Reopening after an error resumes close to where the last stream ended.
+	Open(ctx context.Context) (io.ReadCloser, error)
+}
+
+// NewLogSource creates the log source selected by factorio.log_source.
+func NewLogSource(cfg FactorioConfig) (LogSource, error) {
+	switch cfg.LogSource {
+	case LogSourceKubernetes:
+		k8s, err := NewK8sClient(cfg.Namespace, cfg.Kubeconfig)
+		if err != nil {
+			return nil, fmt.Errorf("kubernetes: %w", err)
+		}
+		return NewK8sLogSource(k8s, cfg.PodLabel), nil
+	case LogSourceFile:
+		return &FileLogSource{path: cfg.LogFile}, nil
+	case LogSourceDocker:
+		return NewDockerLogSource(cfg.DockerSocket, cfg.DockerContainer), nil
+	case LogSourceJournald:
+		// The container image is Alpine, which has no journalctl.
+		if _, err := exec.LookPath("journalctl"); err != nil {
+			return nil, fmt.Errorf("journald: journalctl not found, run the exporter on the host: %w", err)
+		}
+		return &JournaldLogSource{unit: cfg.JournaldUnit}, nil
+	}
+	return nil, fmt.Errorf("unknown log source %q", cfg.LogSource)
+}
+
+// K8sLogSource streams logs of the newest Ready pod matching a label
+// selector. Reconnects resume from the last seen line timestamp and skip
+// lines that were already delivered, so nothing is posted twice.
+type K8sLogSource struct {
+	k8s     *K8sClient
+	watcher *PodWatcher
+	resume  lineResume
+
+	mu  sync.Mutex
+	pod string // pod the resume state belongs to
+}
+
+func NewK8sLogSource(k8s *K8sClient, podLabel string) *K8sLogSource {
+	return &K8sLogSource{k8s: k8s, watcher: NewPodWatcher(k8s, podLabel)}
+}
+
+// Run keeps the pod watch running; it must be started before Open is used.
+func (s *K8sLogSource) Run(ctx context.Context) {
+	s.watcher.Run(ctx)
+}
+
+func (s *K8sLogSource) Name() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pod == "" {
+		return fmt.Sprintf("pods %s/%s", s.k8s.namespace, s.watcher.selector)
+	}
+	return fmt.Sprintf("pod %s/%s", s.k8s.namespace, s.pod)
+}
+
+func (s *K8sLogSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	pod, err := s.watcher.WaitForPod(ctx, 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	q := url.Values{"timestamps": {"true"}}
+	s.mu.Lock()
+	last := s.resume.last()
+	newPod := s.pod != "" && s.pod != pod
+	switch {
+	case newPod:
+		// The server was replaced: read the new pod from its start so
+		// nothing logged before we noticed is lost.
+	case last.IsZero():
+		// First stream (or nothing delivered yet): only follow new lines.
+		q.Set("tailLines", "0")
+	default:
+		// sinceTime has second precision; earlier lines are filtered out.
+		q.Set("sinceTime", last.UTC().Truncate(time.Second).Format(time.RFC3339))
+	}
+	s.mu.Unlock()
+
+	body, err := s.k8s.StreamLogs(ctx, pod, q)
+	if err != nil {
+		// Keep the resume point; the next attempt starts from the same place.
+		return nil, err
+	}
+	s.mu.Lock()
+	if newPod {
+		s.resume.reset()
+	}
+	s.pod = pod
+	s.mu.Unlock()
+	return newTimestampedReader(body, &s.resume), nil
+}
+
+// lineResume remembers the newest delivered line of a stream whose lines
+// start with an RFC 3339 timestamp (Kubernetes and Docker logs with
+// timestamps on), so a reconnect can resume there. Resume requests have
+// second precision or less, so lines at the boundary are remembered and
+// skipped when they are sent again.
+type lineResume struct {
+	mu     sync.Mutex
+	lastTS time.Time       // timestamp of the newest delivered line
+	seen   map[string]bool // lines delivered with timestamp lastTS
+}
+
+func (r *lineResume) last() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastTS
+}
+
+// reset forgets the resume point, e.g. when the stream now belongs to a
+// different pod.
+func (r *lineResume) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastTS = time.Time{}
+	r.seen = nil
+}
+
+// accept reports whether a line is new.
+func (r *lineResume) accept(line string) bool {
+	ts, rest, ok := strings.Cut(line, " ")
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if !ok || err != nil {
+		return true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case t.Before(r.lastTS):
+		return false
+	case t.Equal(r.lastTS):
+		if r.seen[rest] {
+			return false
+		}
+	default:
+		r.lastTS = t
+		r.seen = make(map[string]bool)
+	}
+	r.seen[rest] = true
+	return true
+}
+
+// trimStreamTimestamp removes the RFC 3339 timestamp Kubernetes and Docker
+// put in front of each line. The LogTailer keeps the full line to identify
+// events, so identical lines logged at different times stay distinct.
+func trimStreamTimestamp(line string) string {
+	if ts, rest, ok := strings.Cut(line, " "); ok {
+		if _, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+			return rest
+		}
+	}
+	return line
+}
+
+// timestampedReader passes through only the lines lineResume.accept lets
+// through. The timestamps are kept; see trimStreamTimestamp.
+type timestampedReader struct {
+	body   io.ReadCloser
+	r      *bufio.Reader
+	resume *lineResume
+	buf    []byte
+}
+
+func newTimestampedReader(body io.ReadCloser, resume *lineResume) *timestampedReader {
+	return &timestampedReader{body: body, r: bufio.NewReader(body), resume: resume}
+}
+
+func (l *timestampedReader) Read(p []byte) (int, error) {
+	for len(l.buf) == 0 {
+		line, err := l.r.ReadString('\n')
+		if line != "" {
+			if l.resume.accept(line) {
+				l.buf = []byte(line)
+			}
+		}
+		if err != nil && len(l.buf) == 0 {
+			return 0, err
+		}
+		if err != nil {
+			break
+		}
+	}
+	n := copy(p, l.buf)
+	l.buf = l.buf[n:]
+	return n, nil
+}
+
+func (l *timestampedReader) Close() error { return l.body.Close() }
+
+// FileLogSource follows a local log file such as factorio-current.log. It
+// survives rotation (the server renames the file and starts a new one on
+// restart) and truncation, and resumes at the last read offset.
+type FileLogSource struct {
+	path string
+
+	mu     sync.Mutex
+	info   os.FileInfo // file the offset belongs to
+	offset int64
+}
+
+func (s *FileLogSource) Name() string { return "file " + s.path }
+
+func (s *FileLogSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.info == nil:
+		// First open: only follow new lines, like the Kubernetes source.
+		s.offset = info.Size()
+	case !os.SameFile(s.info, info) || info.Size() < s.offset:
+		s.offset = 0
+	}
+	s.info = info
+	if _, err := f.Seek(s.offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &fileFollower{ctx: ctx, src: s, file: f}, nil
+}
+
+type fileFollower struct {
+	ctx  context.Context
+	src  *FileLogSource
+	file *os.File
+}
+
+func (f *fileFollower) Read(p []byte) (int, error) {
+	for {
+		n, err := f.file.Read(p)
+		if n > 0 {
+			f.src.mu.Lock()
+			f.src.offset += int64(n)
+			f.src.mu.Unlock()
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		select {
+		case <-f.ctx.Done():
+			return 0, io.EOF
+		case <-time.After(filePollInterval):
+		}
+		if err := f.checkRotation(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// checkRotation reopens the path when it now points at a different file, and
+// rewinds when the file was truncated.
+func (f *fileFollower) checkRotation() error {
+	info, err := os.Stat(f.src.path)
+	if err != nil {
+		// Between rename and re-create; try again on the next poll.
+		return nil
+	}
+
+	f.src.mu.Lock()
+	defer f.src.mu.Unlock()
+	if !os.SameFile(f.src.info, info) {
+		nf, err := os.Open(f.src.path)
+		if err != nil {
+			return nil
+		}
+		f.file.Close()
+		f.file = nf
+		f.src.info = info
+		f.src.offset = 0
+		return nil
+	}
+	if info.Size() < f.src.offset {
+		f.src.offset = 0
+		_, err := f.file.Seek(0, io.SeekStart)
+		return err
+	}
+	return nil
+}
+
+func (f *fileFollower) Close() error { return f.file.Close() }
@@ -5,32 +5,21 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"regexp"
 	"time"
 )
 
-var (
-	chatPattern     = regexp.MustCompile(`\[CHAT\]\s+(.+?):\s+(.+)`)
-	joinPattern     = regexp.MustCompile(`(.+?)\s+joined the game`)
-	leavePattern    = regexp.MustCompile(`(.+?)\s+left the game`)
-	researchPattern = regexp.MustCompile(`Research finished:\s+(.+)`)
-	rocketPattern   = regexp.MustCompile(`Rocket launched`)
-	savePattern     = regexp.MustCompile(`Saving game as\s+(.+)`)
-)
-
-// LogTailer tails Factorio server pod logs and fans out parsed events to subscribers.
+// LogTailer tails Factorio server logs and fans out parsed events to subscribers.
 type LogTailer struct {
-	podLabel    string
-	k8s         *K8sClient
-	lastPod     string
+	source      LogSource
+	lastSource  string
+	patterns    []logPattern
 	subscribers []LogSubscriber
+	lifecycle   lifecycleParser
+	tel         *Telemetry
 }
 
-func NewLogTailer(podLabel string, k8s *K8sClient) *LogTailer {
-	return &LogTailer{
-		podLabel: podLabel,
-		k8s:      k8s,
-	}
+func NewLogTailer(source LogSource, patterns []logPattern, tel *Telemetry) *LogTailer {
+	return &LogTailer{source: source, patterns: patterns, tel: tel}
 }
 
 func (t *LogTailer) Subscribe(sub LogSubscriber) {
@@ -44,32 +33,30 @@ func (t *LogTailer) Run(ctx context.Context) {
 				return
 			}
 			log.Printf("log tail error: %v, retrying in 10s", err)
+			t.tel.Report(ctx, "tailer", err)
 		}
 		select {
 		case <-ctx.Done():
 			return
 		case <-time.After(10 * time.Second):
 		}
+		t.tel.Reconnect("tailer")
 	}
 }
 
 func (t *LogTailer) tail(ctx context.Context) error {
-	podName, err := t.k8s.FindPod(ctx, t.podLabel)
+	body, err := t.source.Open(ctx)
 	if err != nil {
-		return fmt.Errorf("find pod: %w", err)
+		return fmt.Errorf("open %s: %w", t.source.Name(), err)
 	}
+	defer body.Close()
+	t.tel.Report(ctx, "tailer", nil)
 
-	if t.lastPod != podName {
-		log.Printf("tailing logs from pod %s/%s", t.k8s.namespace, podName)
-		t.lastPod = podName
+	if name := t.source.Name(); name != t.lastSource {
+		log.Printf("tailing logs from %s", name)
+		t.lastSource = name
 	}
 
-	body, err := t.k8s.StreamLogs(ctx, podName)
-	if err != nil {
-		return fmt.Errorf("stream logs: %w", err)
-	}
-	defer body.Close()
-
 	scanner := bufio.NewScanner(body)
 	for scanner.Scan() {
 		if ctx.Err() != nil {
@@ -80,25 +67,27 @@ func (t *LogTailer) tail(ctx context.Context) error {
 	return scanner.Err()
 }
 
-func (t *LogTailer) parseLine(line string) {
+func (t *LogTailer) parseLine(raw string) {
 	now := time.Now()
+	line := trimStreamTimestamp(raw)
 	var event *GameEvent
 
-	if m := chatPattern.FindStringSubmatch(line); m != nil {
-		event = &GameEvent{Type: "chat", Player: m[1], Message: m[2], Time: now}
-	} else if m := joinPattern.FindStringSubmatch(line); m != nil {
-		event = &GameEvent{Type: "join", Player: m[1], Time: now}
-	} else if m := leavePattern.FindStringSubmatch(line); m != nil {
-		event = &GameEvent{Type: "leave", Player: m[1], Time: now}
-	} else if m := researchPattern.FindStringSubmatch(line); m != nil {
-		event = &GameEvent{Type: "research", Extra: map[string]string{"tech": m[1]}, Time: now}
-	} else if rocketPattern.MatchString(line) {
-		event = &GameEvent{Type: "rocket", Time: now}
-	} else if m := savePattern.FindStringSubmatch(line); m != nil {
-		event = &GameEvent{Type: "save", Extra: map[string]string{"name": m[1]}, Time: now}
+	for i := range t.patterns {
+		if event = t.patterns[i].match(line, now); event != nil {
+			break
+		}
+	}
+	if event == nil {
+		event = t.lifecycle.parse(line, now)
+	}
+	if event != nil && event.Type == "command" && event.Extra["actor"] == "<server>" {
+		// Our own RCON commands (polling, collection) would flood the audit log.
+		return
 	}
 
 	if event != nil {
+		event.Source = SourceLog
+		event.line = raw
 		for _, sub := range t.subscribers {
 			sub.OnLogEvent(*event)
 		}
@@ -0,0 +1,3 @@
+local k={} for n in pairs(t) do if n>cursor then k[#k+1]=n end end table.sort(k)
+local d={} for i=1,math.min(limit,#k) do d[k[i]]=t[k[i]] end
+rcon.print(helpers.table_to_json({data=d,next=#k>limit and k[limit] or nil}))
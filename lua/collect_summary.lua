@@ -0,0 +1,2 @@
+local f=game.forces["player"] local s=game.surfaces[1]
+rcon.print(helpers.table_to_json({tick=game.tick,players=#game.connected_players,evolution=game.forces["enemy"].get_evolution_factor(s),rockets_launched=f.rockets_launched,research=f.current_research and f.current_research.name or nil,research_progress=f.research_progress}))
@@ -0,0 +1,6 @@
+local p=bridge_push
+commands.remove_command("link-discord")
+commands.add_command("link-discord","Link your Discord account to this player",function(c)if c.player_index then p({type="link_request",player=game.get_player(c.player_index).name,tick=c.tick})end end)
+commands.remove_command("discord")
+commands.add_command("discord","<message> - Send a message to Discord",function(c)if c.player_index and c.parameter then p({type="discord_message",player=game.get_player(c.player_index).name,text=c.parameter,tick=c.tick})end end)
+rcon.print("ok")
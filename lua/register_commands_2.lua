@@ -0,0 +1,6 @@
+local p=bridge_push
+commands.remove_command("discord-online")
+commands.add_command("discord-online","List who is online in Discord",function(c)if c.player_index then p({type="discord_online",player=game.get_player(c.player_index).name,tick=c.tick})end end)
+commands.remove_command("report")
+commands.add_command("report","<text> - Report a problem to the moderators",function(c)local i=c.player_index if not(i and c.parameter)then return end storage.bridge_reports=storage.bridge_reports or {} local l=storage.bridge_reports[i] if l and c.tick-l<3600 then game.get_player(i).print("You can send another report in a minute.")return end storage.bridge_reports[i]=c.tick p({type="report",player=game.get_player(i).name,text=c.parameter,tick=c.tick})end)
+rcon.print("ok")
@@ -15,6 +15,11 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1:])
+		return
+	}
+
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
@@ -23,13 +28,6 @@ func main() {
 		log.Fatalf("config: %v", err)
 	}
 
-	// Shared RCON pool
-	rconPool := NewRCONPool(cfg.RCON.Host, cfg.RCON.Port, cfg.RCON.Password)
-	defer rconPool.Close()
-
-	// K8s client
-	k8s := NewK8sClient(cfg.Factorio.Namespace)
-
 	// OTel metric exporter
 	metricExporter, err := otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithInsecure())
 	if err != nil {
@@ -38,7 +36,24 @@ func main() {
 	meterProvider := sdkmetric.NewMeterProvider(
 		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter, sdkmetric.WithInterval(cfg.Metrics.Interval))),
 	)
-	defer meterProvider.Shutdown(ctx)
+	tel, err := NewTelemetry(meterProvider.Meter("factorio-exporter"))
+	if err != nil {
+		log.Fatalf("telemetry: %v", err)
+	}
+
+	// Shared RCON pool
+	rconPool := NewRCONPool(cfg.RCON, tel)
+	defer rconPool.Close()
+	if err := rconPool.RegisterMetrics(meterProvider.Meter("factorio-exporter")); err != nil {
+		log.Fatalf("rcon metrics: %v", err)
+	}
+	companion := NewCompanion(rconPool, cfg.RCON.Mode)
+
+	// Server log source
+	logSource, err := NewLogSource(cfg.Factorio)
+	if err != nil {
+		log.Fatalf("log source: %v", err)
+	}
 
 	// OTel log exporter
 	logExporter, err := otlploggrpc.New(ctx, otlploggrpc.WithInsecure())
@@ -48,28 +63,25 @@ func main() {
 	loggerProvider := sdklog.NewLoggerProvider(
 		sdklog.WithProcessor(sdklog.NewBatchProcessor(logExporter)),
 	)
-	defer loggerProvider.Shutdown(ctx)
 	logger := loggerProvider.Logger(cfg.OTel.ServiceName)
 
 	// Load Lua scripts
-	collectLua := mustReadFile("/lua/collect.lua")
-	registerScripts := []string{
-		mustReadFile("/lua/register_init.lua"),
-		mustReadFile("/lua/register_events_1.lua"),
-		mustReadFile("/lua/register_events_2.lua"),
-		mustReadFile("/lua/register_events_3.lua"),
-	}
+	collectSummaryLua := mustReadFile("/lua/collect_summary.lua")
+	collectPageLua := mustReadFile("/lua/collect_page.lua")
+	registerScripts := loadRegisterScripts()
 	pollEventsLua := mustReadFile("/lua/poll_events.lua")
 
 	// Components
 	var wg sync.WaitGroup
+	live := NewLiveConfig(cfg)
 
 	// 1. Metrics collector
 	if cfg.Metrics.Enabled {
-		collector, err := NewCollector(rconPool, collectLua, meterProvider)
+		collector, err := NewCollector(rconPool, companion, collectSummaryLua, collectPageLua, cfg.Metrics.PageSize, meterProvider, tel)
 		if err != nil {
 			log.Fatalf("collector: %v", err)
 		}
+		live.OnReload(func(c *Config) { collector.SetInterval(c.Metrics.Interval) })
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
@@ -78,15 +90,38 @@ func main() {
 	}
 
 	// 2. Log tailer + subscribers
-	tailer := NewLogTailer(cfg.Factorio.PodLabel, k8s)
+	logPatterns, err := compileLogPatterns(cfg.Factorio.LogPatterns)
+	if err != nil {
+		log.Fatalf("log patterns: %v", err)
+	}
+	tailer := NewLogTailer(logSource, logPatterns, tel)
+
+	otelSub := &OTelLogSubscriber{
+		logger: logger,
+		audit:  loggerProvider.Logger(cfg.OTel.ServiceName + ".audit"),
+		cfg:    live,
+	}
+	pipeline := NewEventPipeline(cfg.Factorio.ServerName, NewCorrelator(cfg.Events.Dedup), tel)
+	pipeline.Subscribe(otelSub)
+	tailer.Subscribe(pipeline)
+
+	if ks, ok := logSource.(*K8sLogSource); ok {
+		podWatcher := ks.watcher
+		podWatcher.Subscribe(pipeline)
+		if err := podWatcher.RegisterMetrics(meterProvider.Meter("factorio")); err != nil {
+			log.Fatalf("pod metrics: %v", err)
+		}
+	}
 
-	otelSub := &OTelLogSubscriber{logger: logger, cfg: &cfg}
-	tailer.Subscribe(otelSub)
+	linker, err := NewAccountLinker(cfg.Linking)
+	if err != nil {
+		log.Fatalf("linking: %v", err)
+	}
 
 	// 3. Discord channel (optional)
 	var channels []Channel
 	if cfg.Discord.Enabled {
-		dc, err := NewDiscordChannel(cfg.Discord.BotToken, cfg.Discord.ChannelID, &cfg)
+		dc, err := NewDiscordChannel(cfg.Discord.BotToken, cfg.Discord.ChannelID, live, linker, tel)
 		if err != nil {
 			log.Fatalf("discord: %v", err)
 		}
@@ -94,15 +129,23 @@ func main() {
 	}
 
 	// 4. Bridge
-	bridge := NewBridge(rconPool, channels)
-	bridgeSub := &BridgeSubscriber{events: bridge.Events()}
-	tailer.Subscribe(bridgeSub)
+	limiter, err := NewInboundLimiter(cfg.Inbound, meterProvider.Meter("factorio-exporter"))
+	if err != nil {
+		log.Fatalf("inbound limiter: %v", err)
+	}
+	live.OnReload(func(c *Config) { limiter.SetConfig(c.Inbound) })
+	bridge := NewBridge(rconPool, companion, channels, NewRichTextTranslator(cfg.RichText),
+		NewInboundSanitizer(cfg.Inbound), limiter, cfg.Inbound.NotifyThrottled, linker, tel)
+	live.OnReload(func(c *Config) { bridge.SetTextConfig(c.RichText, c.Inbound) })
+	bridgeSub := &BridgeSubscriber{events: bridge.Events(), tel: tel}
+	tel.AddQueue("bridge", bridge.QueueDepth)
+	pipeline.Subscribe(bridgeSub)
 
 	// 5. Event poller
 	if cfg.Events.Enabled {
-		poller := NewEventPoller(rconPool, registerScripts, pollEventsLua, cfg.Events.PollInterval)
-		poller.Subscribe(otelSub)
-		poller.Subscribe(bridgeSub)
+		poller := NewEventPoller(rconPool, companion, registerScripts, pollEventsLua, cfg.Events.PollInterval, tel)
+		poller.Subscribe(pipeline)
+		live.OnReload(func(c *Config) { poller.SetInterval(c.Events.PollInterval) })
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
@@ -110,7 +153,42 @@ func main() {
 		}()
 	}
 
+	// 6. Health endpoints
+	if cfg.Health.Enabled {
+		required := []string{"tailer"}
+		if cfg.Metrics.Enabled || cfg.Events.Enabled {
+			required = append(required, "rcon")
+		}
+		if cfg.Events.Enabled {
+			required = append(required, "event_handlers")
+		}
+		if cfg.Discord.Enabled {
+			required = append(required, "discord")
+		}
+		health := NewHealthServer(cfg.Health.Listen, tel, required)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			health.Run(ctx)
+		}()
+	}
+
+	// 7. Config reload on SIGHUP or file change
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		live.Run(ctx)
+	}()
+
 	// Start goroutines
+	if r, ok := logSource.(interface{ Run(context.Context) }); ok {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.Run(ctx)
+		}()
+	}
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -123,11 +201,15 @@ func main() {
 		bridge.FanOutEvents(ctx)
 	}()
 
+	// Channels stay connected after ctx is cancelled so the bridge can drain
+	// into them; they are stopped last.
+	channelCtx, stopChannels := context.WithCancel(context.Background())
+	var channelWG sync.WaitGroup
 	for _, ch := range channels {
-		wg.Add(1)
+		channelWG.Add(1)
 		go func(c Channel) {
-			defer wg.Done()
-			if err := c.Start(ctx); err != nil {
+			defer channelWG.Done()
+			if err := c.Start(channelCtx); err != nil {
 				log.Printf("channel %s: %v", c.Name(), err)
 			}
 		}(ch)
@@ -148,6 +230,39 @@ func main() {
 
 	wg.Wait()
 	log.Println("shutting down")
+
+	// Sources have stopped; deliver what is still queued, then disconnect.
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), cfg.Shutdown.Timeout)
+	bridge.Drain(drainCtx)
+	if cfg.Shutdown.GoodbyeMessage != "" {
+		bridge.Goodbye(drainCtx, cfg.Shutdown.GoodbyeMessage)
+	}
+	cancelDrain()
+	stopChannels()
+	channelWG.Wait()
+
+	// ctx is already cancelled, so flush with a fresh deadline.
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), cfg.Shutdown.Timeout)
+	defer cancelFlush()
+	if err := loggerProvider.Shutdown(flushCtx); err != nil {
+		log.Printf("flush logs: %v", err)
+	}
+	if err := meterProvider.Shutdown(flushCtx); err != nil {
+		log.Printf("flush metrics: %v", err)
+	}
+}
+
+// loadRegisterScripts reads the Lua that installs event handlers and chat
+// commands when the companion mod is not available.
+func loadRegisterScripts() []string {
+	return []string{
+		mustReadFile("/lua/register_init.lua"),
+		mustReadFile("/lua/register_events_1.lua"),
+		mustReadFile("/lua/register_events_2.lua"),
+		mustReadFile("/lua/register_events_3.lua"),
+		mustReadFile("/lua/register_commands_1.lua"),
+		mustReadFile("/lua/register_commands_2.lua"),
+	}
 }
 
 func mustReadFile(path string) string {
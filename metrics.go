@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"strings"
 	"time"
@@ -12,7 +13,38 @@ import (
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 )
 
-// FactorioStats represents the JSON output from the Lua collection script.
+// statCategory is a per-name statistics table that is fetched in pages. lua
+// is an expression for the counts table, with f the player force and s the
+// first surface; the companion mod knows the categories by name.
+type statCategory struct {
+	name  string
+	lua   string
+	field func(*FactorioStats) *map[string]float64
+}
+
+var statCategories = []statCategory{
+	{"item_production", "f.get_item_production_statistics(s).input_counts", func(s *FactorioStats) *map[string]float64 { return &s.ItemProduction }},
+	{"item_consumption", "f.get_item_production_statistics(s).output_counts", func(s *FactorioStats) *map[string]float64 { return &s.ItemConsumption }},
+	{"fluid_production", "f.get_fluid_production_statistics(s).input_counts", func(s *FactorioStats) *map[string]float64 { return &s.FluidProduction }},
+	{"fluid_consumption", "f.get_fluid_production_statistics(s).output_counts", func(s *FactorioStats) *map[string]float64 { return &s.FluidConsumption }},
+	{"kill_counts", "f.get_kill_count_statistics(s).input_counts", func(s *FactorioStats) *map[string]float64 { return &s.KillCounts }},
+	{"entity_built", "f.get_entity_build_count_statistics(s).input_counts", func(s *FactorioStats) *map[string]float64 { return &s.EntityBuilt }},
+	{"power_production", powerStatsLua("input_counts"), func(s *FactorioStats) *map[string]float64 { return &s.PowerProduction }},
+	{"power_consumption", powerStatsLua("output_counts"), func(s *FactorioStats) *map[string]float64 { return &s.PowerConsumption }},
+}
+
+func powerStatsLua(counts string) string {
+	return `(function() local p=s.find_entities_filtered{type="electric-pole",limit=1}[1] return p and p.electric_network_statistics.` + counts + ` or {} end)()`
+}
+
+// statPage is one page of a statistics category. Next is the cursor for the
+// following page, empty on the last one.
+type statPage struct {
+	Data json.RawMessage `json:"data"`
+	Next string          `json:"next"`
+}
+
+// FactorioStats represents the JSON output from the Lua collection scripts.
 type FactorioStats struct {
 	Tick             int64              `json:"tick"`
 	Players          int64              `json:"players"`
@@ -32,8 +64,16 @@ type FactorioStats struct {
 
 // Collector collects Factorio metrics via RCON and exports them as OTel gauges.
 type Collector struct {
-	rcon *RCONPool
-	lua  string
+	rcon       *RCONPool
+	companion  *Companion
+	summaryLua string
+	pageLua    string
+	pageSize   int
+	interval   chan time.Duration // interval changes while running
+
+	tel           *Telemetry
+	duration      metric.Float64Histogram
+	responseBytes metric.Int64Histogram
 
 	players          metric.Int64Gauge
 	evolution        metric.Float64Gauge
@@ -50,11 +90,24 @@ type Collector struct {
 	entityBuilt      metric.Float64Gauge
 }
 
-func NewCollector(pool *RCONPool, luaScript string, mp *sdkmetric.MeterProvider) (*Collector, error) {
+func NewCollector(pool *RCONPool, companion *Companion, summaryLua, pageLua string, pageSize int, mp *sdkmetric.MeterProvider, tel *Telemetry) (*Collector, error) {
 	meter := mp.Meter("factorio")
-	c := &Collector{rcon: pool, lua: luaScript}
+	c := &Collector{rcon: pool, companion: companion, summaryLua: summaryLua, pageLua: pageLua, pageSize: max(pageSize, 1), tel: tel,
+		interval: make(chan time.Duration, 1)}
 
+	self := mp.Meter("factorio-exporter")
 	var err error
+	c.duration, err = self.Float64Histogram("factorio_exporter_collect_duration_seconds",
+		metric.WithDescription("Time to collect all statistics"), metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+	c.responseBytes, err = self.Int64Histogram("factorio_exporter_collect_response_bytes",
+		metric.WithDescription("Size of each RCON collection response"), metric.WithUnit("By"))
+	if err != nil {
+		return nil, err
+	}
+
 	c.players, err = meter.Int64Gauge("factorio_players")
 	if err != nil {
 		return nil, err
@@ -112,6 +165,7 @@ func NewCollector(pool *RCONPool, luaScript string, mp *sdkmetric.MeterProvider)
 }
 
 func (c *Collector) Run(ctx context.Context, interval time.Duration) {
+	ctx = WithRCONKind(WithRCONPriority(ctx, PriorityMetrics), "collect")
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
@@ -121,32 +175,112 @@ func (c *Collector) Run(ctx context.Context, interval time.Duration) {
 		select {
 		case <-ctx.Done():
 			return
+		case d := <-c.interval:
+			ticker.Reset(d)
 		case <-ticker.C:
 			c.collect(ctx)
 		}
 	}
 }
 
+// SetInterval changes the collection interval of a running collector.
+func (c *Collector) SetInterval(d time.Duration) {
+	select {
+	case <-c.interval:
+	default:
+	}
+	c.interval <- d
+}
+
 func (c *Collector) collect(ctx context.Context) {
-	resp, err := c.rcon.Execute("/sc " + c.lua)
-	if err != nil {
+	stats, err := c.Collect(ctx)
+	if stats == nil {
 		log.Printf("metrics collect error: %v", err)
-		return
+	} else {
+		c.record(ctx, stats)
 	}
+	c.tel.Report(ctx, "collector", err)
+}
 
-	resp = strings.TrimSpace(resp)
-	if resp == "" {
-		log.Println("empty response from metrics rcon")
-		return
-	}
+// Collect fetches the summary and then every statistics category page by
+// page, so no single RCON response grows with the size of the factory. A
+// category that fails is logged and left empty, and its error is returned
+// along with the rest of the stats.
+func (c *Collector) Collect(ctx context.Context) (*FactorioStats, error) {
+	start := time.Now()
+	defer func() {
+		c.duration.Record(ctx, time.Since(start).Seconds())
+	}()
 
 	var stats FactorioStats
+	resp, err := c.execute(ctx, "summary", c.companion.Command(ctx, "collect", "summary", c.summaryLua))
+	if err != nil {
+		return nil, err
+	}
 	if err := json.Unmarshal([]byte(resp), &stats); err != nil {
-		log.Printf("metrics json parse error: %v (response: %.200s)", err, resp)
-		return
+		c.companion.Reset()
+		return nil, fmt.Errorf("%w: %v (response: %.200s)", errParse, err, resp)
+	}
+
+	var failed error
+	for _, cat := range statCategories {
+		counts, err := c.collectCategory(ctx, cat)
+		if err != nil {
+			log.Printf("metrics collect %s: %v", cat.name, err)
+			failed = err
+			continue
+		}
+		*cat.field(&stats) = counts
 	}
+	return &stats, failed
+}
+
+// collectCategory pages through one statistics category.
+func (c *Collector) collectCategory(ctx context.Context, cat statCategory) (map[string]float64, error) {
+	counts := make(map[string]float64)
+	cursor := ""
+	for {
+		lua := fmt.Sprintf("local f,s=game.forces.player,game.surfaces[1] local t,cursor,limit=%s,%s,%d ",
+			cat.lua, luaString(cursor), c.pageSize) + c.pageLua
+		args := fmt.Sprintf("%s %d %s", cat.name, c.pageSize, cursor)
+		resp, err := c.execute(ctx, cat.name, c.companion.Command(ctx, "collect", strings.TrimSpace(args), lua))
+		if err != nil {
+			return nil, err
+		}
 
-	c.record(ctx, &stats)
+		var page statPage
+		if err := json.Unmarshal([]byte(resp), &page); err != nil {
+			c.companion.Reset()
+			return nil, fmt.Errorf("%w: %v (response: %.200s)", errParse, err, resp)
+		}
+		// table_to_json encodes an empty table as [].
+		if len(page.Data) > 0 && string(page.Data) != "[]" {
+			if err := json.Unmarshal(page.Data, &counts); err != nil {
+				return nil, fmt.Errorf("%w: %v", errParse, err)
+			}
+		}
+		if page.Next == "" {
+			return counts, nil
+		}
+		if page.Next <= cursor {
+			return nil, fmt.Errorf("%w: cursor did not advance past %q", errParse, cursor)
+		}
+		cursor = page.Next
+	}
+}
+
+// execute runs one collection command and records the response size.
+func (c *Collector) execute(ctx context.Context, category, cmd string) (string, error) {
+	resp, err := c.rcon.Execute(ctx, cmd)
+	if err != nil {
+		return "", err
+	}
+	c.responseBytes.Record(ctx, int64(len(resp)), metric.WithAttributes(attribute.String("category", category)))
+	resp = strings.TrimSpace(resp)
+	if resp == "" {
+		return "", fmt.Errorf("empty response")
+	}
+	return resp, nil
 }
 
 func nameAttribute(name string) attribute.KeyValue {
@@ -0,0 +1,195 @@
+-- factorio-exporter companion mod.
+--
+-- Provides the event queue, stats collection, RCON commands and a remote
+-- interface for the exporter, so it can work without /sc (which disables
+-- achievements and needs console command permission) and without
+-- re-injecting handlers after every reload. The exporter detects the mod via
+-- /fe-version and falls back to Lua injection when it is missing.
+--
+-- The file also works as a scenario's control.lua, but script.on_event
+-- replaces existing handlers for the same event; merge them in that case.
+
+local VERSION = script.active_mods["factorio-exporter"] or "scenario"
+local MAX_EVENTS = 1000
+
+local function push(e)
+  storage.bridge_events = storage.bridge_events or {}
+  table.insert(storage.bridge_events, e)
+  if #storage.bridge_events > MAX_EVENTS then table.remove(storage.bridge_events, 1) end
+end
+
+local function player_name(index)
+  local p = game.get_player(index)
+  return p and p.name or "unknown"
+end
+
+script.on_init(function() storage.bridge_events = {} end)
+script.on_configuration_changed(function() storage.bridge_events = storage.bridge_events or {} end)
+
+script.on_event(defines.events.on_research_started, function(e) push({type="research_started", name=e.research.name, tick=e.tick}) end)
+script.on_event(defines.events.on_research_finished, function(e) push({type="research_finished", name=e.research.name, tick=e.tick}) end)
+script.on_event(defines.events.on_research_cancelled, function(e)
+  for name in pairs(e.research) do push({type="research_cancelled", name=name, tick=e.tick}) end
+end)
+script.on_event(defines.events.on_player_died, function(e)
+  push({type="player_died", player=player_name(e.player_index), cause=e.cause and e.cause.name or "unknown", tick=e.tick})
+end)
+script.on_event(defines.events.on_player_respawned, function(e) push({type="player_respawned", player=player_name(e.player_index), tick=e.tick}) end)
+script.on_event(defines.events.on_player_changed_surface, function(e)
+  local p = game.get_player(e.player_index)
+  push({type="player_changed_surface", player=p.name, surface=p.surface.name, tick=e.tick})
+end)
+script.on_event(defines.events.on_player_promoted, function(e) push({type="player_promoted", player=player_name(e.player_index), tick=e.tick}) end)
+script.on_event(defines.events.on_player_demoted, function(e) push({type="player_demoted", player=player_name(e.player_index), tick=e.tick}) end)
+script.on_event(defines.events.on_rocket_launch_ordered, function(e) push({type="rocket_launch_ordered", tick=e.tick}) end)
+script.on_event(defines.events.on_space_platform_changed_state, function(e)
+  push({type="platform_state_changed", name=e.platform.name, state=tostring(e.platform.state), tick=e.tick})
+end)
+script.on_event(defines.events.on_cargo_pod_finished_ascending, function(e) push({type="cargo_ascended", tick=e.tick}) end)
+script.on_event(defines.events.on_cargo_pod_finished_descending, function(e) push({type="cargo_descended", tick=e.tick}) end)
+script.on_event(defines.events.on_entity_died, function(e)
+  if e.entity and e.entity.type == "unit-spawner" then push({type="spawner_destroyed", name=e.entity.name, tick=e.tick}) end
+end, {{filter="type", type="unit-spawner"}})
+script.on_event(defines.events.on_surface_created, function(e)
+  local s = game.get_surface(e.surface_index)
+  push({type="surface_created", name=s and s.name or "unknown", tick=e.tick})
+end)
+script.on_event(defines.events.on_chart_tag_added, function(e) push({type="tag_added", text=e.tag.text or "", tick=e.tick}) end)
+
+-- Only RCON (no player) may call the exporter commands.
+local function rcon_only(handler)
+  return function(cmd)
+    if cmd.player_index then return end
+    handler(cmd)
+  end
+end
+
+local function summary()
+  local f = game.forces["player"]
+  return {
+    tick = game.tick,
+    players = #game.connected_players,
+    evolution = game.forces["enemy"].get_evolution_factor(game.surfaces[1]),
+    rockets_launched = f.rockets_launched,
+    research = f.current_research and f.current_research.name or nil,
+    research_progress = f.research_progress,
+  }
+end
+
+local function power_counts(s, key)
+  local pole = s.find_entities_filtered{type="electric-pole", limit=1}[1]
+  return pole and pole.electric_network_statistics[key] or {}
+end
+
+-- Per-name statistics tables, fetched by the exporter in pages.
+local categories = {
+  item_production = function(f, s) return f.get_item_production_statistics(s).input_counts end,
+  item_consumption = function(f, s) return f.get_item_production_statistics(s).output_counts end,
+  fluid_production = function(f, s) return f.get_fluid_production_statistics(s).input_counts end,
+  fluid_consumption = function(f, s) return f.get_fluid_production_statistics(s).output_counts end,
+  kill_counts = function(f, s) return f.get_kill_count_statistics(s).input_counts end,
+  entity_built = function(f, s) return f.get_entity_build_count_statistics(s).input_counts end,
+  power_production = function(_, s) return power_counts(s, "input_counts") end,
+  power_consumption = function(_, s) return power_counts(s, "output_counts") end,
+}
+
+local function counts(category)
+  return categories[category](game.forces["player"], game.surfaces[1])
+end
+
+-- Returns up to limit entries of a category with names after cursor (in
+-- name order), and the cursor for the next page if there is one.
+local function collect_page(category, cursor, limit)
+  local t = counts(category)
+  local names = {}
+  for name in pairs(t) do
+    if name > cursor then names[#names + 1] = name end
+  end
+  table.sort(names)
+  local data = {}
+  for i = 1, math.min(limit, #names) do data[names[i]] = t[names[i]] end
+  return {data = data, next = #names > limit and names[limit] or nil}
+end
+
+-- Everything at once, for the remote interface.
+local function collect()
+  local r = summary()
+  for category in pairs(categories) do r[category] = counts(category) end
+  return r
+end
+
+local function drain()
+  local events = storage.bridge_events or {}
+  storage.bridge_events = {}
+  return events
+end
+
+commands.add_command("fe-version", "factorio-exporter: companion version", rcon_only(function()
+  rcon.print("factorio-exporter " .. VERSION)
+end))
+
+commands.add_command("fe-print", "factorio-exporter: print bridged chat", rcon_only(function(cmd)
+  if cmd.parameter then game.print(cmd.parameter) end
+end))
+
+commands.add_command("fe-whisper", "factorio-exporter: print to one player", rcon_only(function(cmd)
+  local name, text = (cmd.parameter or ""):match("^(%S+)%s+(.+)$")
+  local p = name and game.get_player(name)
+  if p then p.print(text) end
+end))
+
+-- /fe-collect summary | /fe-collect <category> <limit> [cursor]
+commands.add_command("fe-collect", "factorio-exporter: collect stats", rcon_only(function(cmd)
+  local category, limit, cursor = (cmd.parameter or ""):match("^(%S+)%s*(%d*)%s*(%S*)$")
+  if category == "summary" then
+    rcon.print(helpers.table_to_json(summary()))
+  elseif category and categories[category] then
+    rcon.print(helpers.table_to_json(collect_page(category, cursor, tonumber(limit) or 200)))
+  else
+    rcon.print(helpers.table_to_json(collect()))
+  end
+end))
+
+commands.add_command("fe-poll", "factorio-exporter: drain event queue", rcon_only(function()
+  rcon.print(helpers.table_to_json(drain()))
+end))
+
+commands.add_command("link-discord", "Link your Discord account to this player", function(cmd)
+  if cmd.player_index then push({type="link_request", player=player_name(cmd.player_index), tick=cmd.tick}) end
+end)
+
+commands.add_command("discord", "<message> - Send a message to Discord", function(cmd)
+  if cmd.player_index and cmd.parameter then
+    push({type="discord_message", player=player_name(cmd.player_index), text=cmd.parameter, tick=cmd.tick})
+  end
+end)
+
+commands.add_command("discord-online", "List who is online in Discord", function(cmd)
+  if cmd.player_index then push({type="discord_online", player=player_name(cmd.player_index), tick=cmd.tick}) end
+end)
+
+-- One report per player per minute, so /report can't be used to spam moderators.
+local REPORT_COOLDOWN = 60 * 60
+
+commands.add_command("report", "<text> - Report a problem to the moderators", function(cmd)
+  local index = cmd.player_index
+  if not (index and cmd.parameter) then return end
+  storage.bridge_reports = storage.bridge_reports or {}
+  local last = storage.bridge_reports[index]
+  if last and cmd.tick - last < REPORT_COOLDOWN then
+    game.get_player(index).print("You can send another report in a minute.")
+    return
+  end
+  storage.bridge_reports[index] = cmd.tick
+  push({type="report", player=player_name(index), text=cmd.parameter, tick=cmd.tick})
+end)
+
+-- Remote interface for other mods and scenarios, e.g.
+-- remote.call("factorio_exporter", "push", {type="custom", text="hello"})
+remote.add_interface("factorio_exporter", {
+  version = function() return VERSION end,
+  push = function(e) push(e) end,
+  poll = function() return drain() end,
+  collect = function() return collect() end,
+  collect_page = function(category, cursor, limit) return collect_page(category, cursor or "", limit or 200) end,
+})
@@ -8,17 +8,40 @@ import (
 )
 
 // OTelLogSubscriber sends GameEvents as structured OTel log records (→ Loki).
+// Moderation events also go to a separate audit logger tagged stream=audit.
 type OTelLogSubscriber struct {
 	logger otellog.Logger
-	cfg    *Config
+	audit  otellog.Logger
+	cfg    *LiveConfig
 }
 
 func (s *OTelLogSubscriber) OnLogEvent(event GameEvent) {
-	if !s.cfg.lokiEventAllowed(event.Type) {
+	cfg := s.cfg.Load()
+	if isModerationEvent(event.Type) && cfg.Loki.Enabled && cfg.Loki.Audit {
+		logEvent(s.audit, event.Type, append(eventAttributes(event), otellog.String("stream", "audit"))...)
+	}
+	if !cfg.lokiEventAllowed(event.Type) {
 		return
 	}
 
-	var attrs []otellog.KeyValue
+	logEvent(s.logger, event.Type, eventAttributes(event)...)
+}
+
+func eventAttributes(event GameEvent) []otellog.KeyValue {
+	attrs := []otellog.KeyValue{
+		otellog.Int("schema_version", EventSchemaVersion),
+		otellog.String("id", event.ID),
+		otellog.String("source", event.Source),
+	}
+	if event.Server != "" {
+		attrs = append(attrs, otellog.String("server", event.Server))
+	}
+	if event.Surface != "" {
+		attrs = append(attrs, otellog.String("surface", event.Surface))
+	}
+	if event.Tick > 0 {
+		attrs = append(attrs, otellog.Int64("tick", event.Tick))
+	}
 	if event.Player != "" {
 		attrs = append(attrs, otellog.String("player", event.Player))
 	}
@@ -28,8 +51,7 @@ func (s *OTelLogSubscriber) OnLogEvent(event GameEvent) {
 	for k, v := range event.Extra {
 		attrs = append(attrs, otellog.String(k, v))
 	}
-
-	logEvent(s.logger, event.Type, attrs...)
+	return attrs
 }
 
 func logEvent(logger otellog.Logger, event string, attrs ...otellog.KeyValue) {
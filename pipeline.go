@@ -0,0 +1,54 @@
+package main
+
+import (
+	"log"
+	"sync"
+)
+
+// EventPipeline sits between event producers (log tailer, event poller, pod
+// watcher) and consumers. It stamps every event with the server name and a
+// stable ID, checks it against the schema, drops duplicates reported by more
+// than one source and fans it out to subscribers.
+type EventPipeline struct {
+	server      string
+	correlator  *Correlator
+	tel         *Telemetry
+	subscribers []LogSubscriber
+
+	mu      sync.Mutex
+	invalid map[string]bool // schema errors already logged
+}
+
+func NewEventPipeline(server string, correlator *Correlator, tel *Telemetry) *EventPipeline {
+	return &EventPipeline{server: server, correlator: correlator, tel: tel, invalid: make(map[string]bool)}
+}
+
+func (p *EventPipeline) Subscribe(sub LogSubscriber) {
+	p.subscribers = append(p.subscribers, sub)
+}
+
+func (p *EventPipeline) OnLogEvent(event GameEvent) {
+	p.tel.EventReceived(event.Source)
+	event.Server = p.server
+	event.ID = eventID(event)
+
+	if err := validateEvent(event); err != nil {
+		// Still deliver the event; log each distinct problem once.
+		p.mu.Lock()
+		first := !p.invalid[err.Error()]
+		p.invalid[err.Error()] = true
+		p.mu.Unlock()
+		if first {
+			log.Printf("event does not match schema v%d: %v", EventSchemaVersion, err)
+		}
+	}
+
+	if p.correlator.Duplicate(event) {
+		p.tel.EventDropped(event.Source, "pipeline", "duplicate")
+		return
+	}
+
+	for _, sub := range p.subscribers {
+		sub.OnLogEvent(event)
+	}
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// k8sPod is the subset of the Pod object used by the exporter.
+type k8sPod struct {
+	Metadata struct {
+		Name              string     `json:"name"`
+		ResourceVersion   string     `json:"resourceVersion"`
+		CreationTimestamp time.Time  `json:"creationTimestamp"`
+		DeletionTimestamp *time.Time `json:"deletionTimestamp"`
+	} `json:"metadata"`
+	Status struct {
+		Phase      string `json:"phase"`
+		Conditions []struct {
+			Type   string `json:"type"`
+			Status string `json:"status"`
+		} `json:"conditions"`
+		ContainerStatuses []k8sContainerStatus `json:"containerStatuses"`
+	} `json:"status"`
+}
+
+type k8sContainerStatus struct {
+	Name         string            `json:"name"`
+	Image        string            `json:"image"`
+	Ready        bool              `json:"ready"`
+	RestartCount int64             `json:"restartCount"`
+	State        k8sContainerState `json:"state"`
+	LastState    k8sContainerState `json:"lastState"`
+}
+
+type k8sContainerState struct {
+	Running *struct {
+		StartedAt time.Time `json:"startedAt"`
+	} `json:"running"`
+	Waiting *struct {
+		Reason string `json:"reason"`
+	} `json:"waiting"`
+	Terminated *struct {
+		Reason   string `json:"reason"`
+		ExitCode int    `json:"exitCode"`
+	} `json:"terminated"`
+}
+
+func (p *k8sPod) ready() bool {
+	if p.Metadata.DeletionTimestamp != nil || p.Status.Phase != "Running" {
+		return false
+	}
+	for _, c := range p.Status.Conditions {
+		if c.Type == "Ready" {
+			return c.Status == "True"
+		}
+	}
+	return false
+}
+
+// PodWatcher keeps an up-to-date view of the pods matching a label selector
+// using the Kubernetes list+watch API, and reports pod lifecycle changes
+// (restarts, crashes, image updates, readiness) as GameEvents.
+type PodWatcher struct {
+	k8s         *K8sClient
+	selector    string
+	subscribers []LogSubscriber
+
+	mu      sync.Mutex
+	pods    map[string]*k8sPod
+	synced  bool              // initial list done; later changes are reported
+	changed chan struct{}     // closed and replaced on every change
+	images  map[string]string // container -> image of the newest Ready pod
+}
+
+func NewPodWatcher(k8s *K8sClient, selector string) *PodWatcher {
+	return &PodWatcher{
+		k8s:      k8s,
+		selector: selector,
+		pods:     make(map[string]*k8sPod),
+		changed:  make(chan struct{}),
+	}
+}
+
+func (w *PodWatcher) Subscribe(sub LogSubscriber) {
+	w.subscribers = append(w.subscribers, sub)
+}
+
+// RegisterMetrics exports restart count, uptime and readiness of the
+// watched containers.
+func (w *PodWatcher) RegisterMetrics(meter metric.Meter) error {
+	restarts, err := meter.Int64ObservableGauge("factorio_server_container_restarts",
+		metric.WithDescription("Restart count of the Factorio server container"))
+	if err != nil {
+		return err
+	}
+	uptime, err := meter.Float64ObservableGauge("factorio_server_uptime_seconds",
+		metric.WithDescription("Seconds since the Factorio server container started"), metric.WithUnit("s"))
+	if err != nil {
+		return err
+	}
+	ready, err := meter.Int64ObservableGauge("factorio_server_ready",
+		metric.WithDescription("Whether the Factorio server container is ready (1) or not (0)"))
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		for _, p := range w.pods {
+			for _, c := range p.Status.ContainerStatuses {
+				attrs := metric.WithAttributes(
+					attribute.String("pod", p.Metadata.Name),
+					attribute.String("container", c.Name),
+				)
+				o.ObserveInt64(restarts, c.RestartCount, attrs)
+				var up float64
+				if c.State.Running != nil {
+					up = time.Since(c.State.Running.StartedAt).Seconds()
+				}
+				o.ObserveFloat64(uptime, up, attrs)
+				var r int64
+				if c.Ready {
+					r = 1
+				}
+				o.ObserveInt64(ready, r, attrs)
+			}
+		}
+		return nil
+	}, restarts, uptime, ready)
+	return err
+}
+
+func (w *PodWatcher) Run(ctx context.Context) {
+	for {
+		if err := w.listAndWatch(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("pod watch error: %v, retrying in 5s", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// BestPod returns the newest Ready pod that is not terminating.
+func (w *PodWatcher) BestPod() (string, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	best := w.bestPodLocked()
+	if best == nil {
+		return "", false
+	}
+	return best.Metadata.Name, true
+}
+
+func (w *PodWatcher) bestPodLocked() *k8sPod {
+	var best *k8sPod
+	for _, p := range w.pods {
+		if !p.ready() {
+			continue
+		}
+		if best == nil || p.Metadata.CreationTimestamp.After(best.Metadata.CreationTimestamp) {
+			best = p
+		}
+	}
+	return best
+}
+
+// WaitForPod blocks until a Ready pod is known, ctx is done or timeout passes.
+func (w *PodWatcher) WaitForPod(ctx context.Context, timeout time.Duration) (string, error) {
+	deadline := time.After(timeout)
+	for {
+		w.mu.Lock()
+		changed := w.changed
+		w.mu.Unlock()
+
+		if name, ok := w.BestPod(); ok {
+			return name, nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-deadline:
+			return "", fmt.Errorf("no ready pod with label %s", w.selector)
+		case <-changed:
+		}
+	}
+}
+
+func (w *PodWatcher) podsPath(extra url.Values) string {
+	q := url.Values{"labelSelector": {w.selector}}
+	for k, v := range extra {
+		q[k] = v
+	}
+	return fmt.Sprintf("/api/v1/namespaces/%s/pods?%s", w.k8s.namespace, q.Encode())
+}
+
+func (w *PodWatcher) listAndWatch(ctx context.Context) error {
+	listCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	resp, err := w.k8s.get(listCtx, w.podsPath(nil))
+	if err != nil {
+		cancel()
+		return fmt.Errorf("list pods: %w", err)
+	}
+	var list struct {
+		Metadata struct {
+			ResourceVersion string `json:"resourceVersion"`
+		} `json:"metadata"`
+		Items []*k8sPod `json:"items"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	cancel()
+	if err != nil {
+		return fmt.Errorf("list pods: %w", err)
+	}
+
+	pods := make(map[string]*k8sPod, len(list.Items))
+	for _, p := range list.Items {
+		pods[p.Metadata.Name] = p
+	}
+	w.replace(pods)
+
+	rv := list.Metadata.ResourceVersion
+	for {
+		rv, err = w.watch(ctx, rv)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// watch consumes one watch stream and returns the last resource version
+// seen, so the caller can resume when the server closes the stream.
+func (w *PodWatcher) watch(ctx context.Context, rv string) (string, error) {
+	resp, err := w.k8s.get(ctx, w.podsPath(url.Values{
+		"watch":               {"1"},
+		"resourceVersion":     {rv},
+		"allowWatchBookmarks": {"true"},
+		"timeoutSeconds":      {"300"},
+	}))
+	if err != nil {
+		return rv, fmt.Errorf("watch pods: %w", err)
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var ev struct {
+			Type   string          `json:"type"`
+			Object json.RawMessage `json:"object"`
+		}
+		if err := dec.Decode(&ev); err != nil {
+			if err == io.EOF {
+				return rv, nil
+			}
+			return rv, fmt.Errorf("watch pods: %w", err)
+		}
+		if ev.Type == "ERROR" {
+			// Usually 410 Gone: our resource version is too old; relist.
+			return rv, fmt.Errorf("watch pods: %s", ev.Object)
+		}
+
+		var pod k8sPod
+		if err := json.Unmarshal(ev.Object, &pod); err != nil {
+			return rv, fmt.Errorf("watch pods: %w", err)
+		}
+		rv = pod.Metadata.ResourceVersion
+		switch ev.Type {
+		case "ADDED", "MODIFIED":
+			w.update(&pod, false)
+		case "DELETED":
+			w.update(&pod, true)
+		}
+	}
+}
+
+func (w *PodWatcher) replace(pods map[string]*k8sPod) {
+	w.mu.Lock()
+	var events []GameEvent
+	if w.synced {
+		for name, p := range pods {
+			events = append(events, podEvents(w.pods[name], p)...)
+		}
+	}
+	w.pods = pods
+	w.synced = true
+	events = append(events, w.imageEventsLocked()...)
+	w.notifyLocked()
+	w.mu.Unlock()
+
+	w.emit(events)
+}
+
+func (w *PodWatcher) update(pod *k8sPod, deleted bool) {
+	w.mu.Lock()
+	var events []GameEvent
+	if deleted {
+		delete(w.pods, pod.Metadata.Name)
+	} else {
+		events = podEvents(w.pods[pod.Metadata.Name], pod)
+		w.pods[pod.Metadata.Name] = pod
+	}
+	events = append(events, w.imageEventsLocked()...)
+	w.notifyLocked()
+	w.mu.Unlock()
+
+	w.emit(events)
+}
+
+func (w *PodWatcher) emit(events []GameEvent) {
+	for _, e := range events {
+		for _, sub := range w.subscribers {
+			sub.OnLogEvent(e)
+		}
+	}
+}
+
+// podEvents compares two versions of a pod and describes what happened to
+// its containers. old is nil for pods that were just created.
+func podEvents(old, cur *k8sPod) []GameEvent {
+	now := time.Now()
+	pod := cur.Metadata.Name
+	var events []GameEvent
+	event := func(typ string, extra map[string]string) {
+		extra["pod"] = pod
+		events = append(events, GameEvent{Type: typ, Source: SourceK8s, Extra: extra, Time: now})
+	}
+
+	wasReady := old != nil && old.ready()
+	if isReady := cur.ready(); isReady != wasReady {
+		if isReady {
+			event("server_ready", map[string]string{})
+		} else if old != nil {
+			event("server_not_ready", map[string]string{})
+		}
+	}
+	if old == nil {
+		return events
+	}
+
+	prev := make(map[string]k8sContainerStatus, len(old.Status.ContainerStatuses))
+	for _, c := range old.Status.ContainerStatuses {
+		prev[c.Name] = c
+	}
+	for _, c := range cur.Status.ContainerStatuses {
+		p, ok := prev[c.Name]
+		if !ok {
+			continue
+		}
+
+		if c.RestartCount > p.RestartCount {
+			extra := map[string]string{
+				"container": c.Name,
+				"restarts":  strconv.FormatInt(c.RestartCount, 10),
+			}
+			if t := c.LastState.Terminated; t != nil && (t.ExitCode != 0 || t.Reason == "OOMKilled") {
+				extra["reason"] = t.Reason
+				extra["exit_code"] = strconv.Itoa(t.ExitCode)
+				event("server_crashed", extra)
+			} else {
+				event("server_restarted", extra)
+			}
+		}
+
+		if w := c.State.Waiting; w != nil && w.Reason != "" && (p.State.Waiting == nil || p.State.Waiting.Reason != w.Reason) {
+			event("server_waiting", map[string]string{"container": c.Name, "reason": w.Reason})
+		}
+	}
+	return events
+}
+
+// imageEventsLocked reports server_updated when the newest Ready pod runs
+// other images than the newest Ready pod did before. That covers rollouts,
+// which replace the pod, as well as image changes in place.
+func (w *PodWatcher) imageEventsLocked() []GameEvent {
+	best := w.bestPodLocked()
+	if best == nil {
+		// Keep the old images while a rollout has no Ready pod yet.
+		return nil
+	}
+	images := make(map[string]string, len(best.Status.ContainerStatuses))
+	for _, c := range best.Status.ContainerStatuses {
+		images[c.Name] = c.Image
+	}
+	var events []GameEvent
+	if w.images != nil {
+		names := make([]string, 0, len(images))
+		for name := range images {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if old, ok := w.images[name]; ok && old != images[name] {
+				events = append(events, GameEvent{Type: "server_updated", Source: SourceK8s, Time: time.Now(), Extra: map[string]string{
+					"pod": best.Metadata.Name, "container": name, "image": images[name], "old_image": old,
+				}})
+			}
+		}
+	}
+	w.images = images
+	return events
+}
+
+func (w *PodWatcher) notifyLocked() {
+	close(w.changed)
+	w.changed = make(chan struct{})
+}
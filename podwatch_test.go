@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testPod(name, image string, created time.Time, ready bool) *k8sPod {
+	p := &k8sPod{}
+	p.Metadata.Name = name
+	p.Metadata.CreationTimestamp = created
+	p.Status.Phase = "Running"
+	status := "False"
+	if ready {
+		status = "True"
+	}
+	p.Status.Conditions = append(p.Status.Conditions, struct {
+		Type   string `json:"type"`
+		Status string `json:"status"`
+	}{"Ready", status})
+	p.Status.ContainerStatuses = []k8sContainerStatus{{Name: "factorio", Image: image, Ready: ready}}
+	return p
+}
+
+func TestPodWatcherRolloutUpdate(t *testing.T) {
+	t0 := time.Date(2024, 10, 21, 10, 0, 0, 0, time.UTC)
+	w := NewPodWatcher(nil, "app=factorio")
+	sub := &recordingSubscriber{}
+	w.Subscribe(sub)
+
+	w.replace(map[string]*k8sPod{"server-a": testPod("server-a", "factorio:2.0.14", t0, true)})
+	// The rollout creates a new pod; it becomes Ready, then the old one goes.
+	w.update(testPod("server-b", "factorio:2.0.15", t0.Add(time.Hour), false), false)
+	w.update(testPod("server-b", "factorio:2.0.15", t0.Add(time.Hour), true), false)
+	w.update(testPod("server-a", "factorio:2.0.14", t0, true), true)
+
+	var updates []map[string]string
+	for _, e := range sub.events {
+		if e.Type == "server_updated" {
+			updates = append(updates, e.Extra)
+		}
+	}
+	want := []map[string]string{{
+		"pod": "server-b", "container": "factorio", "image": "factorio:2.0.15", "old_image": "factorio:2.0.14",
+	}}
+	if !reflect.DeepEqual(updates, want) {
+		t.Errorf("server_updated events = %v, want %v", updates, want)
+	}
+
+	// A new pod with the same image is not an update.
+	sub.events = nil
+	w.update(testPod("server-c", "factorio:2.0.15", t0.Add(2*time.Hour), true), false)
+	for _, e := range sub.events {
+		if e.Type == "server_updated" {
+			t.Errorf("unexpected %+v", e)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Drop reasons reported in factorio_exporter_inbound_dropped and to authors.
+const (
+	dropBlocked     = "blocked"
+	dropTooLong     = "too_long"
+	dropFiltered    = "filtered"
+	dropDuplicate   = "duplicate"
+	dropAuthorLimit = "author_rate_limit"
+	dropGlobalLimit = "global_rate_limit"
+)
+
+// InboundLimiter protects game chat from Discord spam and raids: it applies
+// a user blocklist, a length cap, a word filter, duplicate detection and
+// per-author and global sliding-window rate limits.
+type InboundLimiter struct {
+	cfg     InboundConfig
+	blocked map[string]bool
+	words   []string
+	dropped metric.Int64Counter
+
+	mu        sync.Mutex
+	global    []time.Time
+	authors   map[string]*authorWindow
+	lastSweep time.Time
+}
+
+type authorWindow struct {
+	sent        []time.Time
+	lastContent string    // last forwarded message, lowercased
+	lastAt      time.Time // when lastContent was forwarded
+	notifiedAt  time.Time
+}
+
+func NewInboundLimiter(cfg InboundConfig, meter metric.Meter) (*InboundLimiter, error) {
+	dropped, err := meter.Int64Counter("factorio_exporter_inbound_dropped",
+		metric.WithDescription("Inbound chat messages dropped before reaching the game"))
+	if err != nil {
+		return nil, err
+	}
+
+	l := &InboundLimiter{
+		dropped: dropped,
+		authors: make(map[string]*authorWindow),
+	}
+	l.SetConfig(cfg)
+	return l, nil
+}
+
+// SetConfig replaces the limits, blocklist and word filter. Message history
+// is kept, so a lowered limit applies to messages already sent.
+func (l *InboundLimiter) SetConfig(cfg InboundConfig) {
+	blocked := make(map[string]bool)
+	for _, id := range cfg.BlockedUsers {
+		blocked[id] = true
+	}
+	var words []string
+	for _, w := range cfg.WordFilter {
+		if w = strings.ToLower(strings.TrimSpace(w)); w != "" {
+			words = append(words, w)
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cfg = cfg
+	l.blocked = blocked
+	l.words = words
+}
+
+// Check decides whether msg may be forwarded. It returns "" when allowed,
+// otherwise the drop reason. notify is true at most once per author and rate
+// limit window, so throttling replies can't be used to amplify a raid.
+func (l *InboundLimiter) Check(ctx context.Context, msg InboundMessage) (reason string, notify bool) {
+	reason, notify = l.check(msg, time.Now())
+	if reason != "" {
+		l.dropped.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("reason", reason),
+			attribute.String("source", msg.Source),
+		))
+	}
+	return reason, notify
+}
+
+func (l *InboundLimiter) check(msg InboundMessage, now time.Time) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.blocked[msg.AuthorID] {
+		return dropBlocked, false
+	}
+	if l.cfg.MaxRawLength > 0 && utf8.RuneCountInString(msg.Content) > l.cfg.MaxRawLength {
+		return dropTooLong, true
+	}
+	lower := strings.ToLower(msg.Content)
+	for _, w := range l.words {
+		if strings.Contains(lower, w) {
+			return dropFiltered, true
+		}
+	}
+
+	rl := l.cfg.RateLimit
+	l.sweep(now, rl.Window)
+
+	key := msg.Source + "/" + msg.AuthorID
+	a := l.authors[key]
+	if a == nil {
+		a = &authorWindow{}
+		l.authors[key] = a
+	}
+	notify := func(reason string) (string, bool) {
+		if now.Sub(a.notifiedAt) < rl.Window {
+			return reason, false
+		}
+		a.notifiedAt = now
+		return reason, true
+	}
+
+	// Duplicates are timed from the last forwarded copy, not the last
+	// attempt: repeating a message shows it at most once per window, but
+	// doesn't keep the author blocked for as long as they keep trying.
+	content := strings.TrimSpace(lower)
+	if rl.DuplicateWindow > 0 && content == a.lastContent && now.Sub(a.lastAt) < rl.DuplicateWindow {
+		return notify(dropDuplicate)
+	}
+
+	a.sent = pruneBefore(a.sent, now.Add(-rl.Window))
+	if rl.PerAuthor > 0 && len(a.sent) >= rl.PerAuthor {
+		return notify(dropAuthorLimit)
+	}
+	l.global = pruneBefore(l.global, now.Add(-rl.Window))
+	if rl.Global > 0 && len(l.global) >= rl.Global {
+		return notify(dropGlobalLimit)
+	}
+
+	a.sent = append(a.sent, now)
+	a.lastContent = content
+	a.lastAt = now
+	l.global = append(l.global, now)
+	return "", false
+}
+
+// sweep forgets authors that have been quiet for longer than every window.
+func (l *InboundLimiter) sweep(now time.Time, window time.Duration) {
+	keep := max(window, l.cfg.RateLimit.DuplicateWindow)
+	if now.Sub(l.lastSweep) < keep {
+		return
+	}
+	l.lastSweep = now
+	for key, a := range l.authors {
+		if now.Sub(a.lastAt) > keep && now.Sub(a.notifiedAt) > keep {
+			delete(l.authors, key)
+		}
+	}
+}
+
+// pruneBefore drops timestamps older than cutoff from a sorted slice.
+func pruneBefore(ts []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(ts) && ts[i].Before(cutoff) {
+		i++
+	}
+	return ts[i:]
+}
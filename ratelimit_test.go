@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+func newTestLimiter(t *testing.T, rl RateLimitConfig) *InboundLimiter {
+	t.Helper()
+	l, err := NewInboundLimiter(InboundConfig{RateLimit: rl}, noop.NewMeterProvider().Meter(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestInboundLimiterPerAuthor(t *testing.T) {
+	t0 := time.Date(2024, 10, 21, 10, 0, 0, 0, time.UTC)
+	l := newTestLimiter(t, RateLimitConfig{Window: time.Minute, PerAuthor: 2})
+	msg := func(author, text string) InboundMessage {
+		return InboundMessage{Source: "Discord", AuthorID: author, Content: text}
+	}
+
+	steps := []struct {
+		at     time.Duration
+		msg    InboundMessage
+		reason string
+		notify bool
+	}{
+		{0, msg("a", "one"), "", false},
+		{10 * time.Second, msg("a", "two"), "", false},
+		{20 * time.Second, msg("a", "three"), dropAuthorLimit, true},
+		// Notified once per window only.
+		{30 * time.Second, msg("a", "four"), dropAuthorLimit, false},
+		{30 * time.Second, msg("b", "other author"), "", false},
+		// The first message left the window.
+		{61 * time.Second, msg("a", "five"), "", false},
+		{65 * time.Second, msg("a", "six"), dropAuthorLimit, false},
+		{75 * time.Second, msg("a", "seven"), "", false},
+		// A window after the last notice, the author is told again.
+		{85 * time.Second, msg("a", "eight"), dropAuthorLimit, true},
+	}
+	for _, s := range steps {
+		reason, notify := l.check(s.msg, t0.Add(s.at))
+		if reason != s.reason || notify != s.notify {
+			t.Errorf("%s: %q from %s = (%q, %v), want (%q, %v)",
+				s.at, s.msg.Content, s.msg.AuthorID, reason, notify, s.reason, s.notify)
+		}
+	}
+}
+
+func TestInboundLimiterGlobal(t *testing.T) {
+	t0 := time.Date(2024, 10, 21, 10, 0, 0, 0, time.UTC)
+	l := newTestLimiter(t, RateLimitConfig{Window: time.Minute, Global: 3})
+	for i, author := range []string{"a", "b", "c"} {
+		if reason, _ := l.check(InboundMessage{Source: "Discord", AuthorID: author, Content: "hi"}, t0.Add(time.Duration(i)*time.Second)); reason != "" {
+			t.Fatalf("message %d dropped: %s", i, reason)
+		}
+	}
+	// Each author is notified of the global limit once.
+	for _, tt := range []struct {
+		author string
+		notify bool
+	}{{"d", true}, {"d", false}, {"e", true}} {
+		reason, notify := l.check(InboundMessage{Source: "Discord", AuthorID: tt.author, Content: "hi"}, t0.Add(10*time.Second))
+		if reason != dropGlobalLimit || notify != tt.notify {
+			t.Errorf("%s: (%q, %v), want (%q, %v)", tt.author, reason, notify, dropGlobalLimit, tt.notify)
+		}
+	}
+	if reason, _ := l.check(InboundMessage{Source: "Discord", AuthorID: "d", Content: "hi"}, t0.Add(time.Minute+time.Second)); reason != "" {
+		t.Errorf("after the window: dropped %s", reason)
+	}
+}
+
+func TestInboundLimiterDuplicate(t *testing.T) {
+	t0 := time.Date(2024, 10, 21, 10, 0, 0, 0, time.UTC)
+	l := newTestLimiter(t, RateLimitConfig{Window: time.Minute, DuplicateWindow: 30 * time.Second})
+	msg := InboundMessage{Source: "Discord", AuthorID: "a", Content: "Spam"}
+
+	steps := []struct {
+		at      time.Duration
+		content string
+		reason  string
+	}{
+		{0, "Spam", ""},
+		{5 * time.Second, " spam ", dropDuplicate},
+		{10 * time.Second, "something else", ""},
+		// Only the last forwarded message counts.
+		{15 * time.Second, "spam", ""},
+		{25 * time.Second, "spam", dropDuplicate},
+		{40 * time.Second, "spam", dropDuplicate},
+		// Rejected copies don't extend the window: it runs from the copy
+		// forwarded at 15s.
+		{45 * time.Second, "spam", ""},
+	}
+	for _, s := range steps {
+		msg.Content = s.content
+		if reason, _ := l.check(msg, t0.Add(s.at)); reason != s.reason {
+			t.Errorf("%s: %q = %q, want %q", s.at, s.content, reason, s.reason)
+		}
+	}
+}
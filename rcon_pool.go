@@ -1,75 +1,363 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"sync"
+	"time"
 
 	"github.com/gorcon/rcon"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
 )
 
-// RCONPool provides a shared, mutex-protected RCON connection with auto-reconnect.
+// RCON priorities. When all connections are busy, a freed connection goes to
+// the highest waiting priority, and metrics collection never occupies every
+// connection, so chat and event polling aren't stuck behind a slow collect.
+const (
+	PriorityMetrics = iota
+	PriorityEvents
+	PriorityChat
+	numPriorities
+)
+
+var priorityNames = [numPriorities]string{"metrics", "events", "chat"}
+
+const (
+	rconMinBackoff = 500 * time.Millisecond
+	rconMaxBackoff = 30 * time.Second
+
+	// rconMaxIdle is how long a free connection is kept. Older ones are
+	// closed instead of reused: a connection dropped by the server or a
+	// proxy only fails once the command is sent, when it can't be retried.
+	rconMaxIdle = 30 * time.Second
+)
+
+type (
+	rconPriorityKey struct{}
+	rconKindKey     struct{}
+)
+
+// WithRCONPriority marks RCON commands run with ctx as the given priority.
+// Commands without a priority run as PriorityEvents.
+func WithRCONPriority(ctx context.Context, priority int) context.Context {
+	return context.WithValue(ctx, rconPriorityKey{}, priority)
+}
+
+// WithRCONKind labels RCON commands run with ctx for the latency metric,
+// e.g. "collect" or "print".
+func WithRCONKind(ctx context.Context, kind string) context.Context {
+	return context.WithValue(ctx, rconKindKey{}, kind)
+}
+
+func rconKind(ctx context.Context) string {
+	if k, ok := ctx.Value(rconKindKey{}).(string); ok {
+		return k
+	}
+	return "other"
+}
+
+// rconError is a failed RCON command; class is connect, execute or timeout.
+type rconError struct {
+	class string
+	err   error
+}
+
+func (e *rconError) Error() string { return "rcon " + e.class + ": " + e.err.Error() }
+func (e *rconError) Unwrap() error { return e.err }
+
+func rconPriority(ctx context.Context) int {
+	if p, ok := ctx.Value(rconPriorityKey{}).(int); ok && p >= 0 && p < numPriorities {
+		return p
+	}
+	return PriorityEvents
+}
+
+// RCONPool keeps up to Size RCON connections, hands them out by priority and
+// reconnects with exponential backoff.
 type RCONPool struct {
 	addr     string
 	password string
-	mu       sync.Mutex
-	conn     *rcon.Conn
+	size     int
+	timeout  time.Duration
+	tel      *Telemetry
+
+	mu      sync.Mutex
+	idle    []idleConn // connected and free, oldest first
+	inUse   [numPriorities]int
+	waiters [numPriorities][]chan struct{}
+	closed  bool
+
+	backoff   time.Duration
+	nextDial  time.Time
+	lastError error
+
+	waitTime metric.Float64Histogram
 }
 
-func NewRCONPool(host, port, password string) *RCONPool {
-	return &RCONPool{
-		addr:     net.JoinHostPort(host, port),
-		password: password,
-	}
+type idleConn struct {
+	conn  *rcon.Conn
+	since time.Time
 }
 
-// Execute runs an RCON command, reconnecting on failure.
-func (p *RCONPool) Execute(cmd string) (string, error) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
+func NewRCONPool(cfg RCONConfig, tel *Telemetry) *RCONPool {
+	p := &RCONPool{
+		addr:     net.JoinHostPort(cfg.Host, cfg.Port),
+		password: cfg.Password,
+		size:     max(cfg.PoolSize, 1),
+		timeout:  cfg.Timeout,
+		tel:      tel,
+	}
+	// Replaced by RegisterMetrics.
+	_ = p.RegisterMetrics(noop.NewMeterProvider().Meter(""))
+	return p
+}
 
-	conn, err := p.getConn()
+// RegisterMetrics exports connections in use and wait time. Latency and
+// errors are recorded through Telemetry.
+func (p *RCONPool) RegisterMetrics(meter metric.Meter) error {
+	inUse, err := meter.Int64ObservableGauge("factorio_exporter_rcon_connections_in_use",
+		metric.WithDescription("RCON connections currently running a command"))
+	if err != nil {
+		return err
+	}
+	p.waitTime, err = meter.Float64Histogram("factorio_exporter_rcon_wait_seconds",
+		metric.WithDescription("Time spent waiting for a free RCON connection"), metric.WithUnit("s"))
 	if err != nil {
-		return "", fmt.Errorf("rcon connect: %w", err)
+		return err
 	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		for prio, n := range p.inUse {
+			o.ObserveInt64(inUse, int64(n), metric.WithAttributes(attribute.String("priority", priorityNames[prio])))
+		}
+		return nil
+	}, inUse)
+	return err
+}
 
+// Execute runs an RCON command. It waits for a free connection until ctx is
+// done, and gives up on the command after the configured timeout. A command
+// that could not be written to a reused idle connection is retried on another
+// one; anything that may have reached the server is not. Errors are
+// *rconError.
+func (p *RCONPool) Execute(ctx context.Context, cmd string) (string, error) {
+	start := time.Now()
+	resp, err := p.execute(ctx, cmd)
+	p.tel.RCONDuration(ctx, rconKind(ctx), time.Since(start))
+	p.tel.Report(ctx, "rcon", err)
+	return resp, err
+}
+
+func (p *RCONPool) execute(ctx context.Context, cmd string) (string, error) {
+	prio := rconPriority(ctx)
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	if err := p.acquire(ctx, prio); err != nil {
+		return "", &rconError{"timeout", err}
+	}
+	p.waitTime.Record(ctx, time.Since(start).Seconds(),
+		metric.WithAttributes(attribute.String("priority", priorityNames[prio])))
+
+	var err error
+	for {
+		conn, reused, cerr := p.connect()
+		if cerr != nil {
+			err = &rconError{"connect", cerr}
+			break
+		}
+		resp, xerr := p.run(ctx, conn, cmd)
+		if xerr == nil {
+			p.release(prio, conn)
+			return resp, nil
+		}
+		conn.Close()
+		if ctx.Err() != nil {
+			err = &rconError{"timeout", ctx.Err()}
+			break
+		}
+		err = &rconError{"execute", xerr}
+		// An idle connection may have gone stale. Only retry when the
+		// command never reached the server, so it can't run twice.
+		if !reused || !notSent(xerr) {
+			break
+		}
+	}
+	p.release(prio, nil)
+	return "", err
+}
+
+// notSent reports whether an Execute error happened before the command was
+// written, i.e. setting the write deadline or writing to the socket failed.
+func notSent(err error) bool {
+	var op *net.OpError
+	return errors.As(err, &op) && (op.Op == "write" || op.Op == "set")
+}
+
+// run executes cmd, closing the connection if ctx ends first so a hung
+// socket can't block the caller.
+func (p *RCONPool) run(ctx context.Context, conn *rcon.Conn, cmd string) (string, error) {
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
 	resp, err := conn.Execute(cmd)
-	if err != nil {
-		// Connection may be stale; close and retry once
-		p.conn.Close()
-		p.conn = nil
+	if !stop() && err == nil {
+		err = ctx.Err()
+	}
+	return resp, err
+}
+
+// acquire reserves a connection slot for prio. A waiter that was woken but
+// lost the slot to another caller keeps its place at the head of the queue.
+func (p *RCONPool) acquire(ctx context.Context, prio int) error {
+	p.mu.Lock()
+	woken := false
+	for {
+		if p.closed {
+			p.mu.Unlock()
+			return errors.New("rcon pool closed")
+		}
+		if p.canRunLocked(prio) {
+			p.inUse[prio]++
+			p.mu.Unlock()
+			return nil
+		}
+		ch := make(chan struct{})
+		if woken {
+			p.waiters[prio] = append([]chan struct{}{ch}, p.waiters[prio]...)
+		} else {
+			p.waiters[prio] = append(p.waiters[prio], ch)
+		}
+		p.mu.Unlock()
+
+		select {
+		case <-ch:
+			woken = true
+		case <-ctx.Done():
+			p.mu.Lock()
+			p.removeWaiterLocked(prio, ch)
+			p.mu.Unlock()
+			return fmt.Errorf("wait for connection: %w", ctx.Err())
+		}
+		p.mu.Lock()
+	}
+}
+
+func (p *RCONPool) canRunLocked(prio int) bool {
+	busy := 0
+	for _, n := range p.inUse {
+		busy += n
+	}
+	if busy >= p.size {
+		return false
+	}
+	for hi := prio + 1; hi < numPriorities; hi++ {
+		if len(p.waiters[hi]) > 0 {
+			return false
+		}
+	}
+	if prio == PriorityMetrics && p.size > 1 && p.inUse[prio] >= p.size-1 {
+		return false
+	}
+	return true
+}
 
-		conn, err = p.getConn()
-		if err != nil {
-			return "", fmt.Errorf("rcon reconnect: %w", err)
+func (p *RCONPool) removeWaiterLocked(prio int, ch chan struct{}) {
+	ws := p.waiters[prio]
+	for i, w := range ws {
+		if w == ch {
+			p.waiters[prio] = append(ws[:i], ws[i+1:]...)
+			return
 		}
-		resp, err = conn.Execute(cmd)
-		if err != nil {
-			p.conn.Close()
-			p.conn = nil
-			return "", fmt.Errorf("rcon execute after reconnect: %w", err)
+	}
+	// Already woken; pass the wakeup on.
+	p.wakeLocked()
+}
+
+// wakeLocked wakes the oldest waiter of the highest priority.
+func (p *RCONPool) wakeLocked() {
+	for prio := numPriorities - 1; prio >= 0; prio-- {
+		if ws := p.waiters[prio]; len(ws) > 0 {
+			close(ws[0])
+			p.waiters[prio] = ws[1:]
+			return
 		}
 	}
-	return resp, nil
 }
 
-func (p *RCONPool) getConn() (*rcon.Conn, error) {
-	if p.conn != nil {
-		return p.conn, nil
+// release returns a slot; conn is nil when the connection was dropped.
+func (p *RCONPool) release(prio int, conn *rcon.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.inUse[prio]--
+	if conn != nil && !p.closed {
+		p.idle = append(p.idle, idleConn{conn, time.Now()})
+	} else if conn != nil {
+		conn.Close()
 	}
-	conn, err := rcon.Dial(p.addr, p.password)
+	p.wakeLocked()
+}
+
+// connect returns an idle connection (reused is true) or dials a new one,
+// honoring backoff. Connections idle for longer than rconMaxIdle are closed.
+func (p *RCONPool) connect() (conn *rcon.Conn, reused bool, err error) {
+	p.mu.Lock()
+	for len(p.idle) > 0 && time.Since(p.idle[0].since) > rconMaxIdle {
+		p.idle[0].conn.Close()
+		p.idle = p.idle[1:]
+	}
+	if n := len(p.idle); n > 0 {
+		conn := p.idle[n-1].conn
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		return conn, true, nil
+	}
+	if wait := time.Until(p.nextDial); wait > 0 {
+		err := p.lastError
+		p.mu.Unlock()
+		return nil, false, fmt.Errorf("%w (retrying in %s)", err, wait.Round(time.Millisecond))
+	}
+	p.mu.Unlock()
+
+	opts := []rcon.Option{rcon.SetDialTimeout(5 * time.Second)}
+	if p.timeout > 0 {
+		opts = append(opts, rcon.SetDeadline(p.timeout))
+	}
+	conn, err = rcon.Dial(p.addr, p.password, opts...)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	if err != nil {
-		return nil, err
+		p.backoff = min(max(p.backoff*2, rconMinBackoff), rconMaxBackoff)
+		p.nextDial = time.Now().Add(p.backoff)
+		p.lastError = err
+		return nil, false, err
 	}
-	p.conn = conn
-	return conn, nil
+	p.backoff = 0
+	p.nextDial = time.Time{}
+	return conn, false, nil
 }
 
 func (p *RCONPool) Close() error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	if p.conn != nil {
-		return p.conn.Close()
+	p.closed = true
+	for _, ic := range p.idle {
+		ic.conn.Close()
+	}
+	p.idle = nil
+	for prio := range p.waiters {
+		for _, ch := range p.waiters[prio] {
+			close(ch)
+		}
+		p.waiters[prio] = nil
 	}
 	return nil
 }
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unicode"
+)
+
+// configWatchInterval is how often the config file is checked for changes.
+// Kubernetes updates mounted ConfigMaps by swapping a symlink, so the content
+// is compared rather than the modification time.
+const configWatchInterval = 10 * time.Second
+
+// liveConfigFields are the config paths (and their children) applied without
+// a restart. Everything else is logged as needing one.
+var liveConfigFields = []string{
+	"metrics.interval", // collection only; the OTLP export interval is fixed at startup
+	"events.poll_interval",
+	"discord.events",
+	"discord.admin_channel_id",
+	"discord.moderator_role_id",
+	"discord.voice_channel_id",
+	"loki",
+	"rich_text",
+	"inbound.max_length",
+	"inbound.max_raw_length",
+	"inbound.rich_text_allow",
+	"inbound.rich_text_deny",
+	"inbound.rate_limit",
+	"inbound.word_filter",
+	"inbound.blocked_users",
+}
+
+func liveConfigField(path string) bool {
+	for _, f := range liveConfigFields {
+		if path == f || strings.HasPrefix(path, f+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// LiveConfig holds the running configuration. It reloads on SIGHUP or when
+// the config file changes, swapping in the runtime-safe fields atomically.
+type LiveConfig struct {
+	cur atomic.Pointer[Config]
+
+	mu       sync.Mutex
+	data     []byte // config file content at the last (re)load
+	onReload []func(*Config)
+}
+
+func NewLiveConfig(cfg Config) *LiveConfig {
+	l := &LiveConfig{}
+	l.cur.Store(&cfg)
+	l.data, _ = os.ReadFile(configPath())
+	return l
+}
+
+// Load returns the current configuration. Callers must not modify it.
+func (l *LiveConfig) Load() *Config {
+	return l.cur.Load()
+}
+
+// OnReload registers fn to be called with the new configuration after a
+// reload that changed a runtime-safe field.
+func (l *LiveConfig) OnReload(fn func(*Config)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.onReload = append(l.onReload, fn)
+}
+
+func (l *LiveConfig) Run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(configWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.Println("SIGHUP received, reloading config")
+			l.Reload()
+		case <-ticker.C:
+			data, err := os.ReadFile(configPath())
+			if err != nil {
+				continue
+			}
+			l.mu.Lock()
+			changed := !bytes.Equal(data, l.data)
+			l.mu.Unlock()
+			if changed {
+				log.Println("config file changed, reloading")
+				l.Reload()
+			}
+		}
+	}
+}
+
+// Reload reads the configuration again and applies the runtime-safe fields
+// that changed. An invalid configuration is logged and ignored.
+func (l *LiveConfig) Reload() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.data, _ = os.ReadFile(configPath())
+	next, err := loadConfig()
+	if err != nil {
+		log.Printf("config reload: %v (keeping current config)", err)
+		return
+	}
+
+	merged := *l.cur.Load()
+	var applied, restart []string
+	diffConfig("", reflect.ValueOf(&merged).Elem(), reflect.ValueOf(next), func(path string, cur, next reflect.Value) {
+		if liveConfigField(path) {
+			cur.Set(next)
+			applied = append(applied, path)
+		} else {
+			restart = append(restart, path)
+		}
+	})
+
+	if len(applied) == 0 && len(restart) == 0 {
+		log.Println("config reload: no changes")
+		return
+	}
+	if len(applied) > 0 {
+		l.cur.Store(&merged)
+		for _, fn := range l.onReload {
+			fn(&merged)
+		}
+		log.Printf("config reload: applied %s", strings.Join(applied, ", "))
+	}
+	if len(restart) > 0 {
+		log.Printf("config reload: restart needed for %s", strings.Join(restart, ", "))
+	}
+}
+
+// diffConfig calls fn for every leaf field that differs between the structs
+// a and b, with its dotted YAML path (e.g. "inbound.rate_limit.window").
+func diffConfig(prefix string, a, b reflect.Value, fn func(path string, a, b reflect.Value)) {
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		path := configFieldName(t.Field(i))
+		if prefix != "" {
+			path = prefix + "." + path
+		}
+		fa, fb := a.Field(i), b.Field(i)
+		if fa.Kind() == reflect.Struct {
+			diffConfig(path, fa, fb, fn)
+			continue
+		}
+		if !reflect.DeepEqual(fa.Interface(), fb.Interface()) {
+			fn(path, fa, fb)
+		}
+	}
+}
+
+// configFieldName is the YAML key of a config field, or its snake_case name
+// for fields that are only set from the environment.
+func configFieldName(f reflect.StructField) string {
+	if name, _, _ := strings.Cut(f.Tag.Get("yaml"), ","); name != "" && name != "-" {
+		return name
+	}
+	return snakeCase(f.Name)
+}
+
+func snakeCase(s string) string {
+	r := []rune(s)
+	var b strings.Builder
+	for i, c := range r {
+		if i > 0 && unicode.IsUpper(c) &&
+			(unicode.IsLower(r[i-1]) || (i+1 < len(r) && unicode.IsLower(r[i+1]))) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToLower(c))
+	}
+	return b.String()
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// richTextTag matches Factorio rich text tags such as [item=iron-plate],
+// [gps=12,34,nauvis], [color=red] and their closing forms [/color].
+var richTextTag = regexp.MustCompile(`\[(/?)([a-z][a-z-]*)(?:=([^\[\]]*))?\]`)
+
+// RichTextTranslator turns Factorio rich text into plain, human-readable text
+// for external chat platforms. It is shared by all Channel implementations.
+type RichTextTranslator struct {
+	mapURL string            // template with {surface}, {x}, {y} placeholders
+	emoji  map[string]string // prototype name -> emoji (e.g. custom Discord emoji)
+}
+
+func NewRichTextTranslator(cfg RichTextConfig) *RichTextTranslator {
+	return &RichTextTranslator{
+		mapURL: cfg.MapURL,
+		emoji:  cfg.Emoji,
+	}
+}
+
+// TranslateEvent returns a copy of the event with rich text in user-visible
+// fields translated.
+func (t *RichTextTranslator) TranslateEvent(e GameEvent) GameEvent {
+	e.Message = t.Translate(e.Message)
+	if len(e.Extra) > 0 {
+		extra := make(map[string]string, len(e.Extra))
+		for k, v := range e.Extra {
+			extra[k] = t.Translate(v)
+		}
+		e.Extra = extra
+	}
+	return e
+}
+
+// Translate replaces every recognized rich text tag in s. Unknown tags are
+// left untouched.
+func (t *RichTextTranslator) Translate(s string) string {
+	if !strings.Contains(s, "[") {
+		return s
+	}
+	return richTextTag.ReplaceAllStringFunc(s, func(tag string) string {
+		m := richTextTag.FindStringSubmatch(tag)
+		closing, kind, value := m[1] != "", m[2], m[3]
+
+		switch kind {
+		case "color", "font":
+			return ""
+		}
+		if closing {
+			return tag
+		}
+
+		switch kind {
+		case "item", "fluid", "recipe", "entity", "technology", "virtual-signal",
+			"tile", "item-group", "achievement", "equipment", "planet", "space-location":
+			return t.prototype(value)
+		case "img":
+			// [img=item/iron-plate] or [img=utility/warning_icon]
+			if i := strings.LastIndex(value, "/"); i >= 0 {
+				value = value[i+1:]
+			}
+			return t.prototype(value)
+		case "quality":
+			return humanizeName(value)
+		case "gps":
+			return t.gps(value)
+		case "special-item":
+			return "[blueprint]"
+		case "armor":
+			return fmt.Sprintf("[armor of %s]", value)
+		case "train":
+			return fmt.Sprintf("[train %s]", value)
+		case "train-stop":
+			return fmt.Sprintf("[train stop %s]", value)
+		case "space-platform":
+			return fmt.Sprintf("[space platform %s]", value)
+		case "tooltip":
+			// [tooltip=text,locale-key]: keep the visible text only
+			text, _, _ := strings.Cut(value, ",")
+			return text
+		}
+		return tag
+	})
+}
+
+// prototype renders "iron-plate" or "iron-plate,quality=rare" as an emoji
+// (when configured) or a readable name such as "Iron plate (rare)".
+func (t *RichTextTranslator) prototype(value string) string {
+	name, rest, _ := strings.Cut(value, ",")
+	out := humanizeName(name)
+	if e, ok := t.emoji[name]; ok {
+		out = e
+	}
+	if q, ok := strings.CutPrefix(rest, "quality="); ok && q != "normal" {
+		out += " (" + q + ")"
+	}
+	return out
+}
+
+// gps renders "x,y[,surface]" as readable coordinates, optionally with a link
+// to the configured web map.
+func (t *RichTextTranslator) gps(value string) string {
+	parts := strings.Split(value, ",")
+	if len(parts) < 2 {
+		return "📍"
+	}
+	x, y := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+	surface := "nauvis"
+	if len(parts) > 2 && parts[2] != "" {
+		surface = strings.TrimSpace(parts[2])
+	}
+
+	text := fmt.Sprintf("📍 %s, %s (%s)", x, y, surface)
+	if t.mapURL == "" {
+		return text
+	}
+	// The values come from players, so each is escaped to stay one path
+	// segment or query value of the link.
+	link := strings.NewReplacer("{surface}", urlEscape(surface), "{x}", urlEscape(x), "{y}", urlEscape(y)).Replace(t.mapURL)
+	return text + " " + link
+}
+
+// urlEscape escapes everything but unreserved characters, so the result is
+// safe in a path, a query or a fragment.
+func urlEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// humanizeName converts a prototype name like "iron-gear-wheel" to "Iron gear wheel".
+func humanizeName(name string) string {
+	name = strings.TrimSpace(strings.ReplaceAll(name, "-", " "))
+	if name == "" {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
@@ -0,0 +1,47 @@
+package main
+
+import "testing"
+
+func TestRichTextTranslate(t *testing.T) {
+	tr := NewRichTextTranslator(RichTextConfig{
+		MapURL: "https://map.example.com/#/{surface}/{x}/{y}?zoom=3",
+		Emoji:  map[string]string{"iron-plate": "<:iron_plate:123>"},
+	})
+	tests := []struct {
+		in, want string
+	}{
+		// gps
+		{"[gps=12,-34]", "📍 12, -34 (nauvis) https://map.example.com/#/nauvis/12/-34?zoom=3"},
+		{"[gps=1.5,2,vulcanus]", "📍 1.5, 2 (vulcanus) https://map.example.com/#/vulcanus/1.5/2?zoom=3"},
+		{"[gps=1]", "📍"},
+		{"[gps=1,2,a/../b?x=1&y=2#f]",
+			"📍 1, 2 (a/../b?x=1&y=2#f) https://map.example.com/#/a%2F..%2Fb%3Fx%3D1%26y%3D2%23f/1/2?zoom=3"},
+		{"[gps=1) (https://evil,2]", "📍 1) (https://evil, 2 (nauvis) https://map.example.com/#/nauvis/1%29%20%28https%3A%2F%2Fevil/2?zoom=3"},
+		{"[gps=<x> y,2]", "📍 <x> y, 2 (nauvis) https://map.example.com/#/nauvis/%3Cx%3E%20y/2?zoom=3"},
+
+		// items and other prototypes
+		{"[item=iron-plate]", "<:iron_plate:123>"},
+		{"[item=iron-gear-wheel]", "Iron gear wheel"},
+		{"[item=iron-gear-wheel,quality=rare]", "Iron gear wheel (rare)"},
+		{"[item=iron-gear-wheel,quality=normal]", "Iron gear wheel"},
+		{"[entity=small-biter]", "Small biter"},
+		{"[entity=iron-plate]", "<:iron_plate:123>"},
+		{"[img=item/iron-plate] x", "<:iron_plate:123> x"},
+
+		// formatting and unknown tags
+		{"[color=red]hi[/color] [font=default-bold]there[/font]", "hi there"},
+		{"[unknown=thing] stays", "[unknown=thing] stays"},
+		{"[/item]", "[/item]"},
+		{"no tags", "no tags"},
+	}
+	for _, tt := range tests {
+		if got := tr.Translate(tt.in); got != tt.want {
+			t.Errorf("Translate(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	plain := NewRichTextTranslator(RichTextConfig{})
+	if got, want := plain.Translate("[gps=1,2,nauvis]"), "📍 1, 2 (nauvis)"; got != want {
+		t.Errorf("without map_url: got %q, want %q", got, want)
+	}
+}
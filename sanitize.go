@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	maxAuthorRunes = 64
+	maxSourceRunes = 16
+)
+
+// inboundTag matches anything Factorio might interpret as a rich text tag,
+// including closing tags and odd casing/whitespace.
+var inboundTag = regexp.MustCompile(`\[\s*/?\s*([A-Za-z][A-Za-z_-]*)\s*(?:=[^\[\]]*)?\]`)
+
+// InboundSanitizer makes messages from external channels safe to display
+// in game: rich text is filtered by an allow/deny policy, control characters
+// are removed and text is truncated on rune boundaries.
+type InboundSanitizer struct {
+	maxLength int
+	allow     map[string]bool // empty = every tag not denied is allowed
+	deny      map[string]bool
+}
+
+func NewInboundSanitizer(cfg InboundConfig) *InboundSanitizer {
+	s := &InboundSanitizer{
+		maxLength: cfg.MaxLength,
+		allow:     make(map[string]bool),
+		deny:      make(map[string]bool),
+	}
+	for _, t := range cfg.RichTextAllow {
+		s.allow[strings.ToLower(t)] = true
+	}
+	for _, t := range cfg.RichTextDeny {
+		s.deny[strings.ToLower(t)] = true
+	}
+	return s
+}
+
+// Line renders an inbound message as the text shown in game chat. It
+// returns false when nothing is left to show after sanitizing.
+func (s *InboundSanitizer) Line(msg InboundMessage) (string, bool) {
+	if s.Content(msg.Content) == "" {
+		return "", false
+	}
+	// Truncate before filtering, so a cut can't leave half a tag behind.
+	content := truncateRunes(cleanText(msg.Content), s.maxLength)
+	source := truncateRunes(s.plain(msg.Source), maxSourceRunes)
+	author := truncateRunes(s.plain(msg.Author), maxAuthorRunes)
+
+	// Filter the joined text: a name ending in "[gps=1,2" and content "]"
+	// only form a tag together. A tag that starts in the name is never
+	// allowed.
+	body := s.filterJoined(author+": ", content)
+	return fmt.Sprintf("[color=purple][%s][/color] %s", source, body), true
+}
+
+// Content cleans message text, keeping only allowed rich text tags.
+func (s *InboundSanitizer) Content(text string) string {
+	return s.filterTags(cleanText(text), s.tagAllowed)
+}
+
+// plain cleans names, which may never carry rich text.
+func (s *InboundSanitizer) plain(text string) string {
+	return s.filterTags(cleanText(text), func(string) bool { return false })
+}
+
+func (s *InboundSanitizer) tagAllowed(tag string) bool {
+	tag = strings.ToLower(tag)
+	if s.deny[tag] {
+		return false
+	}
+	return len(s.allow) == 0 || s.allow[tag]
+}
+
+// filterTags removes disallowed tags until none remain, so nested input like
+// "[col[color=red]or=red]" cannot reassemble into a tag after one pass.
+func (s *InboundSanitizer) filterTags(text string, allowed func(string) bool) string {
+	for {
+		out := inboundTag.ReplaceAllStringFunc(text, func(tag string) string {
+			if allowed(inboundTag.FindStringSubmatch(tag)[1]) {
+				return tag
+			}
+			return ""
+		})
+		if out == text {
+			return strings.TrimSpace(out)
+		}
+		text = out
+	}
+}
+
+// filterJoined filters prefix+text like filterTags, except that every tag
+// starting inside prefix is removed, even one that is otherwise allowed.
+func (s *InboundSanitizer) filterJoined(prefix, text string) string {
+	text, n := prefix+text, len(prefix)
+	for {
+		removed := false
+		for _, m := range inboundTag.FindAllStringSubmatchIndex(text, -1) {
+			if m[0] < n || !s.tagAllowed(text[m[2]:m[3]]) {
+				if m[0] < n {
+					n -= min(m[1], n) - m[0]
+				}
+				text = text[:m[0]] + text[m[1]:]
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			return strings.TrimSpace(text)
+		}
+	}
+}
+
+// cleanText replaces invalid UTF-8 and control characters (including
+// newlines) with spaces.
+func cleanText(text string) string {
+	text = strings.ToValidUTF8(text, " ")
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == ' ' || r == ' ' {
+			return ' '
+		}
+		return r
+	}, text)
+}
+
+// truncateRunes shortens text to at most max runes without splitting a
+// multi-byte character.
+func truncateRunes(text string, max int) string {
+	if max <= 0 || utf8.RuneCountInString(text) <= max {
+		return text
+	}
+	n := 0
+	for i := range text {
+		if n == max {
+			return text[:i] + "..."
+		}
+		n++
+	}
+	return text
+}
+
+// luaString encodes text as a double-quoted Lua string literal. Backslashes,
+// quotes and every non-printable ASCII byte are escaped, so the result can be
+// interpolated into a /sc command without changing the surrounding code.
+func luaString(text string) string {
+	text = strings.ToValidUTF8(text, "?")
+	var b strings.Builder
+	b.Grow(len(text) + 2)
+	b.WriteByte('"')
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '\\' || c == '"':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			// Always three digits so a following digit isn't absorbed.
+			fmt.Fprintf(&b, `\%03d`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
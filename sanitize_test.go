@@ -0,0 +1,216 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// decodeLuaString parses a double-quoted Lua literal as produced by
+// luaString, failing on anything Lua would read differently.
+func decodeLuaString(t *testing.T, lit string) string {
+	t.Helper()
+	if len(lit) < 2 || lit[0] != '"' || lit[len(lit)-1] != '"' {
+		t.Fatalf("not a quoted literal: %q", lit)
+	}
+	body := lit[1 : len(lit)-1]
+	var b strings.Builder
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case c == '"':
+			t.Fatalf("unescaped quote at %d in %q", i, lit)
+		case c == '\n' || c == '\r' || c < 0x20 || c == 0x7f:
+			t.Fatalf("raw control byte %#x at %d in %q", c, i, lit)
+		case c == '\\':
+			if i+1 >= len(body) {
+				t.Fatalf("dangling backslash in %q", lit)
+			}
+			switch n := body[i+1]; {
+			case n == '\\' || n == '"':
+				b.WriteByte(n)
+				i++
+			case i+3 < len(body) && isDigits(body[i+1:i+4]):
+				v, _ := strconv.Atoi(body[i+1 : i+4])
+				if v > 255 {
+					t.Fatalf("escape out of range in %q", lit)
+				}
+				b.WriteByte(byte(v))
+				i += 3
+			default:
+				t.Fatalf("unexpected escape \\%c in %q", n, lit)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func FuzzLuaString(f *testing.F) {
+	for _, s := range []string{
+		"",
+		"hello",
+		`" .. os.exit() .. "`,
+		"a\\\"b",
+		"line\nbreak\r\x00\x1f\x7f",
+		"\\0651",
+		"]] print('x') --[[",
+		"日本語 🚀",
+		"\xff\xfe bad utf-8",
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, in string) {
+		lit := luaString(in)
+		if got, want := decodeLuaString(t, lit), strings.ToValidUTF8(in, "?"); got != want {
+			t.Fatalf("round trip: got %q, want %q", got, want)
+		}
+	})
+}
+
+func TestFilterTagsNested(t *testing.T) {
+	s := NewInboundSanitizer(InboundConfig{MaxLength: 200, RichTextAllow: []string{"item"}})
+	tests := []struct {
+		in, want string
+	}{
+		{"[color=red]hi[/color]", "hi"},
+		{"[col[color=red]or=red]hi", "hi"},
+		{"[[font=default-bold]font=default-bold]x[/font]", "x"},
+		{"[ COLOR = red ]x[ / color ]", "x"},
+		{"[item=iron-plate] ok", "[item=iron-plate] ok"},
+		{"[it[gps=1,2]em=iron-plate]", "[item=iron-plate]"},
+		{"[img=item/iron-plate][Img=x]", ""},
+		{"no tags [here", "no tags [here"},
+	}
+	for _, tt := range tests {
+		if got := s.Content(tt.in); got != tt.want {
+			t.Errorf("Content(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	// Names never keep tags, not even allowed ones.
+	if got := s.plain("[item=iron-plate]bob[color=red]"); got != "bob" {
+		t.Errorf("plain = %q, want %q", got, "bob")
+	}
+}
+
+func TestTruncateRunes(t *testing.T) {
+	tests := []struct {
+		in   string
+		max  int
+		want string
+	}{
+		{"hello", 10, "hello"},
+		{"hello", 5, "hello"},
+		{"hello", 4, "hell..."},
+		{"日本語テキスト", 3, "日本語..."},
+		{"🚀🚀🚀", 2, "🚀🚀..."},
+		{"héllo", 2, "hé..."},
+		{"anything", 0, "anything"},
+	}
+	for _, tt := range tests {
+		got := truncateRunes(tt.in, tt.max)
+		if got != tt.want {
+			t.Errorf("truncateRunes(%q, %d) = %q, want %q", tt.in, tt.max, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("truncateRunes(%q, %d) split a rune: %q", tt.in, tt.max, got)
+		}
+	}
+}
+
+func TestLineMaxLength(t *testing.T) {
+	s := NewInboundSanitizer(InboundConfig{MaxLength: 5, RichTextAllow: []string{"item"}})
+	line, ok := s.Line(InboundMessage{Source: "Discord", Author: "bob", Content: "ééééééé\nx"})
+	if !ok {
+		t.Fatal("Line dropped the message")
+	}
+	if want := "[color=purple][Discord][/color] bob: ééééé..."; line != want {
+		t.Errorf("Line = %q, want %q", line, want)
+	}
+	if _, ok := s.Line(InboundMessage{Source: "Discord", Author: "bob", Content: "[color=red][/color]"}); ok {
+		t.Error("Line kept a message that is empty after sanitizing")
+	}
+}
+
+func TestLineJoin(t *testing.T) {
+	s := NewInboundSanitizer(InboundConfig{MaxLength: 200, RichTextAllow: []string{"item", "gps"}})
+	tests := []struct {
+		author, content, want string
+	}{
+		{"bob", "look [item=iron-plate]", "bob: look [item=iron-plate]"},
+		// The name and the content only form a tag together.
+		{"bob[gps=1,2", "]", "bob"},
+		{"bob[gps=1,2", "] hi [gps=3,4]", "bob hi [gps=3,4]"},
+		{"[color=red]bob", "[gps=1,2]", "bob: [gps=1,2]"},
+	}
+	for _, tt := range tests {
+		line, _ := s.Line(InboundMessage{Source: "Discord", Author: tt.author, Content: tt.content})
+		if want := "[color=purple][Discord][/color] " + tt.want; line != want {
+			t.Errorf("Line(%q, %q) = %q, want %q", tt.author, tt.content, line, want)
+		}
+	}
+
+	// Truncation happens before filtering, so an allowed tag is never cut in
+	// half into something that still parses as a tag.
+	s = NewInboundSanitizer(InboundConfig{MaxLength: 12, RichTextAllow: []string{"item"}})
+	line, _ := s.Line(InboundMessage{Source: "Discord", Author: "bob", Content: "ab [item=iron-plate]"})
+	if want := "[color=purple][Discord][/color] bob: ab [item=iro..."; line != want {
+		t.Errorf("Line = %q, want %q", line, want)
+	}
+}
+
+func FuzzLine(f *testing.F) {
+	for _, s := range [][2]string{
+		{"bob", "hello"},
+		{"bob[gps=1,2", "]"},
+		{"[color=red]bob[/color]", "[item=iron-plate] [img=x]"},
+		{"a[", "item=iron-plate]"},
+		{"é", strings.Repeat("é", 300)},
+		{"x\n", "[col[color=red]or=red]hi"},
+	} {
+		f.Add(s[0], s[1])
+	}
+	s := NewInboundSanitizer(InboundConfig{MaxLength: 50, RichTextAllow: []string{"item"}})
+	const prefix = "[color=purple][Discord][/color] "
+	f.Fuzz(func(t *testing.T, author, content string) {
+		line, ok := s.Line(InboundMessage{Source: "Discord", Author: author, Content: content})
+		if !ok {
+			return
+		}
+		body, found := strings.CutPrefix(line, prefix)
+		if !found {
+			t.Fatalf("missing prefix: %q", line)
+		}
+		if !utf8.ValidString(line) {
+			t.Fatalf("invalid UTF-8: %q", line)
+		}
+		for _, r := range line {
+			if r < 0x20 || r == 0x7f {
+				t.Fatalf("control character in %q", line)
+			}
+		}
+		for _, m := range inboundTag.FindAllStringSubmatch(body, -1) {
+			if !s.tagAllowed(m[1]) {
+				t.Fatalf("disallowed tag %q in %q", m[0], line)
+			}
+		}
+		if name, _, ok := strings.Cut(body, ": "); ok && inboundTag.MatchString(name) {
+			t.Fatalf("tag starts in the name: %q", line)
+		}
+		if n := utf8.RuneCountInString(body); n > maxAuthorRunes+3+2+50+3 {
+			t.Fatalf("body has %d runes: %q", n, line)
+		}
+	})
+}
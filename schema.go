@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// EventSchemaVersion is bumped whenever a field is renamed, removed or
+// changes type. Adding event types or optional fields keeps the version.
+const EventSchemaVersion = 1
+
+// Event sources.
+const (
+	SourceLog  = "log"
+	SourceRCON = "rcon"
+	SourceK8s  = "k8s"
+)
+
+// eventField describes one key of GameEvent.Extra.
+type eventField struct {
+	Name        string
+	Type        string // "string" or "integer"
+	Required    bool
+	Description string
+}
+
+// eventSchema documents one event type.
+type eventSchema struct {
+	Type        string
+	Description string
+	Player      bool // GameEvent.Player is required
+	Message     bool // GameEvent.Message is required
+	Fields      []eventField
+}
+
+func str(name, desc string) eventField     { return eventField{name, "string", true, desc} }
+func optStr(name, desc string) eventField  { return eventField{name, "string", false, desc} }
+func integer(name, desc string) eventField { return eventField{name, "integer", true, desc} }
+func optInt(name, desc string) eventField  { return eventField{name, "integer", false, desc} }
+func actor() eventField                    { return str("actor", "Who performed the action (player or <server>)") }
+func reason() eventField                   { return optStr("reason", "Reason given, if any") }
+func podField() eventField                 { return str("pod", "Kubernetes pod name") }
+func containerField() eventField           { return str("container", "Container name") }
+
+// eventSchemas lists every event type the exporter produces.
+var eventSchemas = []eventSchema{
+	// Server log
+	{Type: "chat", Description: "Player chat message", Player: true, Message: true},
+	{Type: "join", Description: "Player joined", Player: true},
+	{Type: "leave", Description: "Player left", Player: true},
+	{Type: "research", Description: "Research finished (log)", Fields: []eventField{str("name", "Technology name")}},
+	{Type: "rocket", Description: "Rocket launched (log)"},
+	{Type: "save", Description: "Game saved", Fields: []eventField{str("name", "Save name")}},
+	{Type: "kick", Description: "Player kicked", Player: true, Fields: []eventField{actor(), reason()}},
+	{Type: "ban", Description: "Player banned", Player: true, Fields: []eventField{actor(), reason()}},
+	{Type: "unban", Description: "Player unbanned", Player: true, Fields: []eventField{actor()}},
+	{Type: "promote", Description: "Player promoted to admin (log)", Player: true, Fields: []eventField{actor()}},
+	{Type: "demote", Description: "Player demoted from admin (log)", Player: true, Fields: []eventField{actor()}},
+	{Type: "command", Description: "Console command run by a player", Fields: []eventField{actor(), str("command", "Command line")}},
+	{Type: "server_starting", Description: "Server process started", Fields: []eventField{
+		str("version", "Factorio version"), integer("build", "Factorio build number")}},
+	{Type: "server_loading", Description: "Server is loading a map", Fields: []eventField{str("map", "Save file name")}},
+	{Type: "server_started", Description: "Server is in game and accepting players", Fields: []eventField{
+		optStr("version", "Factorio version"), optInt("build", "Factorio build number"),
+		integer("mods", "Number of loaded mods"), optStr("map", "Save file name"), optStr("address", "Listen address")}},
+	{Type: "server_stopped", Description: "Server shut down", Fields: []eventField{str("reason", "Quit reason or signal (SIGTERM, SIGINT)")}},
+	{Type: "server_crashed", Description: "Server crashed (log or Kubernetes)", Fields: []eventField{
+		str("reason", "Signal, crash marker or termination reason (e.g. OOMKilled)"),
+		optStr("message", "Log line"), optInt("exit_code", "Container exit code"),
+		optStr("pod", "Kubernetes pod name"), optStr("container", "Container name"),
+		optInt("restarts", "Container restart count")}},
+	{Type: "desync", Description: "Multiplayer desync", Fields: []eventField{
+		str("message", "Log line"), optInt("peer", "Peer ID of the desynced client")}},
+	{Type: "server_error", Description: "Error line in the server log", Fields: []eventField{str("message", "Error message")}},
+
+	// Kubernetes
+	{Type: "server_ready", Description: "Server pod became ready", Fields: []eventField{podField()}},
+	{Type: "server_not_ready", Description: "Server pod stopped being ready", Fields: []eventField{podField()}},
+	{Type: "server_restarted", Description: "Server container restarted cleanly", Fields: []eventField{
+		podField(), containerField(), integer("restarts", "Container restart count")}},
+	{Type: "server_updated", Description: "Server container image changed", Fields: []eventField{
+		podField(), containerField(), str("image", "New image"), str("old_image", "Previous image")}},
+	{Type: "server_waiting", Description: "Server container is waiting (e.g. CrashLoopBackOff)", Fields: []eventField{
+		podField(), containerField(), str("reason", "Waiting reason")}},
+
+	// RCON event handlers
+	{Type: "research_started", Description: "Research started", Fields: []eventField{str("name", "Technology name")}},
+	{Type: "research_finished", Description: "Research finished (RCON)", Fields: []eventField{str("name", "Technology name")}},
+	{Type: "research_cancelled", Description: "Research cancelled", Fields: []eventField{str("name", "Technology name")}},
+	{Type: "player_died", Description: "Player died", Player: true, Fields: []eventField{str("cause", "Killing entity, or unknown")}},
+	{Type: "player_respawned", Description: "Player respawned", Player: true},
+	{Type: "player_changed_surface", Description: "Player moved to another surface (see surface)", Player: true},
+	{Type: "player_promoted", Description: "Player promoted to admin (RCON)", Player: true},
+	{Type: "player_demoted", Description: "Player demoted from admin (RCON)", Player: true},
+	{Type: "rocket_launch_ordered", Description: "Rocket launch ordered"},
+	{Type: "platform_state_changed", Description: "Space platform state changed", Fields: []eventField{
+		str("name", "Platform name"), str("state", "New state")}},
+	{Type: "cargo_ascended", Description: "Cargo pod reached orbit"},
+	{Type: "cargo_descended", Description: "Cargo pod landed"},
+	{Type: "spawner_destroyed", Description: "Enemy spawner destroyed", Fields: []eventField{str("name", "Spawner prototype")}},
+	{Type: "surface_created", Description: "Surface created", Fields: []eventField{str("name", "Surface name")}},
+	{Type: "tag_added", Description: "Map tag added", Fields: []eventField{str("text", "Tag text")}},
+	{Type: "link_request", Description: "Player ran /link-discord", Player: true},
+	{Type: "discord_message", Description: "Player ran /discord", Player: true, Fields: []eventField{str("text", "Message")}},
+	{Type: "discord_online", Description: "Player ran /discord-online", Player: true},
+	{Type: "report", Description: "Player ran /report", Player: true, Fields: []eventField{str("text", "Report text")}},
+}
+
+// commonFields may appear on any event.
+var commonFields = []eventField{
+	optStr("discord_id", "Discord user linked to the player"),
+}
+
+var schemaByType = func() map[string]*eventSchema {
+	m := make(map[string]*eventSchema, len(eventSchemas))
+	for i := range eventSchemas {
+		m[eventSchemas[i].Type] = &eventSchemas[i]
+	}
+	return m
+}()
+
+// knownEventType reports whether t is a documented event type.
+func knownEventType(t string) bool {
+	_, ok := schemaByType[t]
+	return ok
+}
+
+// validateEvent checks an event against its schema. Unknown types (e.g.
+// from custom log patterns) are accepted as-is.
+func validateEvent(e GameEvent) error {
+	s, ok := schemaByType[e.Type]
+	if !ok {
+		return nil
+	}
+	if s.Player && e.Player == "" {
+		return fmt.Errorf("%s: player is required", e.Type)
+	}
+	if s.Message && e.Message == "" {
+		return fmt.Errorf("%s: message is required", e.Type)
+	}
+	for _, f := range s.Fields {
+		v, ok := e.Extra[f.Name]
+		if !ok {
+			if f.Required {
+				return fmt.Errorf("%s: %s is required", e.Type, f.Name)
+			}
+			continue
+		}
+		if f.Type == "integer" {
+			if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+				return fmt.Errorf("%s: %s must be an integer, got %q", e.Type, f.Name, v)
+			}
+		}
+	}
+	return nil
+}
+
+// typedData converts Extra to typed values according to the schema.
+func typedData(e GameEvent) map[string]any {
+	data := make(map[string]any, len(e.Extra))
+	types := make(map[string]string)
+	if s, ok := schemaByType[e.Type]; ok {
+		for _, f := range s.Fields {
+			types[f.Name] = f.Type
+		}
+	}
+	for k, v := range e.Extra {
+		if types[k] == "integer" {
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				data[k] = n
+				continue
+			}
+		}
+		data[k] = v
+	}
+	return data
+}
+
+// eventJSONSchema returns the JSON Schema for serialized GameEvents.
+func eventJSONSchema() map[string]any {
+	fieldSchema := func(fields []eventField) (map[string]any, []string) {
+		props := make(map[string]any)
+		var required []string
+		for _, f := range append(append([]eventField(nil), fields...), commonFields...) {
+			props[f.Name] = map[string]any{"type": f.Type, "description": f.Description}
+			if f.Required {
+				required = append(required, f.Name)
+			}
+		}
+		sort.Strings(required)
+		return props, required
+	}
+
+	// One if/then rule per known type; custom types only need the base shape.
+	var rules []any
+	for _, s := range eventSchemas {
+		props, required := fieldSchema(s.Fields)
+		data := map[string]any{"type": "object", "properties": props}
+		if len(required) > 0 {
+			data["required"] = required
+		}
+		top := []string{"type"}
+		if s.Player {
+			top = append(top, "player")
+		}
+		if s.Message {
+			top = append(top, "message")
+		}
+		if len(required) > 0 {
+			top = append(top, "data")
+		}
+		rules = append(rules, map[string]any{
+			"description": s.Description,
+			"if":          map[string]any{"properties": map[string]any{"type": map[string]any{"const": s.Type}}},
+			"then":        map[string]any{"required": top, "properties": map[string]any{"data": data}},
+		})
+	}
+
+	return map[string]any{
+		"$schema":  "https://json-schema.org/draft/2020-12/schema",
+		"$id":      fmt.Sprintf("https://github.com/manamana32321/factorio-exporter/schema/events/v%d.json", EventSchemaVersion),
+		"title":    "factorio-exporter event",
+		"type":     "object",
+		"required": []string{"schema_version", "id", "type", "source", "time"},
+		"properties": map[string]any{
+			"schema_version": map[string]any{"const": EventSchemaVersion},
+			"id":             map[string]any{"type": "string", "description": "Stable event ID"},
+			"type":           map[string]any{"type": "string"},
+			"source":         map[string]any{"enum": []string{SourceLog, SourceRCON, SourceK8s}},
+			"server":         map[string]any{"type": "string", "description": "Server name (factorio.server_name)"},
+			"surface":        map[string]any{"type": "string"},
+			"tick":           map[string]any{"type": "integer", "description": "Game tick (RCON events only)"},
+			"time":           map[string]any{"type": "string", "format": "date-time"},
+			"player":         map[string]any{"type": "string"},
+			"message":        map[string]any{"type": "string"},
+			"data":           map[string]any{"type": "object", "additionalProperties": map[string]any{"type": []string{"string", "integer"}}},
+		},
+		"allOf": rules,
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// errParse marks responses that could not be decoded.
+var errParse = errors.New("parse")
+
+// errorClass classifies an error for the error counter: the RCON failure
+// class (connect, execute, timeout), parse, or other.
+func errorClass(err error) string {
+	var re *rconError
+	switch {
+	case errors.As(err, &re):
+		return re.class
+	case errors.Is(err, errParse):
+		return "parse"
+	}
+	return "other"
+}
+
+// A failing component counts as not ready after notReadyAfter failed runs in
+// a row, or once it has been failing for notReadyWindow (components such as
+// the Discord gateway report a failure once and then stay quiet), so a single
+// timeout doesn't flap /readyz.
+const (
+	notReadyAfter  = 3
+	notReadyWindow = 30 * time.Second
+)
+
+// componentStatus is the last known state of one exporter component.
+type componentStatus struct {
+	up          bool
+	failures    int       // consecutive failed runs
+	failingFrom time.Time // first failure of the current run of failures
+	lastSuccess time.Time
+	lastError   string
+	lastErrorAt time.Time
+}
+
+// ready reports whether the component has succeeded at least once and is
+// not failing for too long now.
+func (s componentStatus) ready(now time.Time) bool {
+	if s.lastSuccess.IsZero() {
+		return false
+	}
+	return s.failures == 0 || (s.failures < notReadyAfter && now.Sub(s.failingFrom) < notReadyWindow)
+}
+
+// Telemetry records the exporter's own health: RCON latency, errors by
+// class, per-component status, event flow and queue depths.
+type Telemetry struct {
+	rconDuration   metric.Float64Histogram
+	errors         metric.Int64Counter
+	eventsReceived metric.Int64Counter
+	eventsDropped  metric.Int64Counter
+	reconnects     metric.Int64Counter
+
+	mu         sync.Mutex
+	components map[string]*componentStatus
+	queues     map[string]func() int
+}
+
+func NewTelemetry(meter metric.Meter) (*Telemetry, error) {
+	t := &Telemetry{
+		components: make(map[string]*componentStatus),
+		queues:     make(map[string]func() int),
+	}
+
+	var err error
+	t.rconDuration, err = meter.Float64Histogram("factorio_exporter_rcon_duration_seconds",
+		metric.WithDescription("RCON command latency by command kind"), metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+	t.errors, err = meter.Int64Counter("factorio_exporter_errors",
+		metric.WithDescription("Component failures by class (connect, execute, timeout, parse, other)"))
+	if err != nil {
+		return nil, err
+	}
+	t.eventsReceived, err = meter.Int64Counter("factorio_exporter_events_received",
+		metric.WithDescription("Game events received per source"))
+	if err != nil {
+		return nil, err
+	}
+	t.eventsDropped, err = meter.Int64Counter("factorio_exporter_events_dropped",
+		metric.WithDescription("Game events not delivered, per source, subscriber and reason"))
+	if err != nil {
+		return nil, err
+	}
+	t.reconnects, err = meter.Int64Counter("factorio_exporter_reconnects",
+		metric.WithDescription("Stream reconnects per component"))
+	if err != nil {
+		return nil, err
+	}
+
+	up, err := meter.Int64ObservableGauge("factorio_exporter_up",
+		metric.WithDescription("Whether the component's last run succeeded (1) or failed (0)"))
+	if err != nil {
+		return nil, err
+	}
+	lastSuccess, err := meter.Float64ObservableGauge("factorio_exporter_last_success_timestamp_seconds",
+		metric.WithDescription("Unix time of the component's last successful run"), metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+	queueDepth, err := meter.Int64ObservableGauge("factorio_exporter_queue_depth",
+		metric.WithDescription("Items waiting in internal queues"))
+	if err != nil {
+		return nil, err
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		for name, s := range t.components {
+			attrs := metric.WithAttributes(attribute.String("component", name))
+			var v int64
+			if s.up {
+				v = 1
+			}
+			o.ObserveInt64(up, v, attrs)
+			if !s.lastSuccess.IsZero() {
+				o.ObserveFloat64(lastSuccess, float64(s.lastSuccess.UnixNano())/1e9, attrs)
+			}
+		}
+		for name, depth := range t.queues {
+			o.ObserveInt64(queueDepth, int64(depth()), metric.WithAttributes(attribute.String("queue", name)))
+		}
+		return nil
+	}, up, lastSuccess, queueDepth)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Report records the outcome of one run of a component (a collection, a
+// poll, a log stream). err == nil marks it up.
+func (t *Telemetry) Report(ctx context.Context, component string, err error) {
+	t.mu.Lock()
+	s := t.components[component]
+	if s == nil {
+		s = &componentStatus{}
+		t.components[component] = s
+	}
+	now := time.Now()
+	s.up = err == nil
+	if err == nil {
+		s.lastSuccess = now
+		s.failures = 0
+	} else {
+		if s.failures == 0 {
+			s.failingFrom = now
+		}
+		s.failures++
+		s.lastError = err.Error()
+		s.lastErrorAt = now
+	}
+	t.mu.Unlock()
+
+	if err != nil {
+		t.errors.Add(context.WithoutCancel(ctx), 1, metric.WithAttributes(
+			attribute.String("component", component),
+			attribute.String("class", errorClass(err)),
+		))
+	}
+}
+
+// Statuses returns a copy of every component's status.
+func (t *Telemetry) Statuses() map[string]componentStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[string]componentStatus, len(t.components))
+	for name, s := range t.components {
+		out[name] = *s
+	}
+	return out
+}
+
+// RCONDuration records the latency of one RCON command.
+func (t *Telemetry) RCONDuration(ctx context.Context, kind string, d time.Duration) {
+	t.rconDuration.Record(context.WithoutCancel(ctx), d.Seconds(), metric.WithAttributes(attribute.String("kind", kind)))
+}
+
+func (t *Telemetry) EventReceived(source string) {
+	t.eventsReceived.Add(context.Background(), 1, metric.WithAttributes(attribute.String("source", source)))
+}
+
+func (t *Telemetry) EventDropped(source, subscriber, reason string) {
+	t.eventsDropped.Add(context.Background(), 1, metric.WithAttributes(
+		attribute.String("source", source),
+		attribute.String("subscriber", subscriber),
+		attribute.String("reason", reason),
+	))
+}
+
+func (t *Telemetry) Reconnect(component string) {
+	t.reconnects.Add(context.Background(), 1, metric.WithAttributes(attribute.String("component", component)))
+}
+
+// AddQueue exports the depth of a queue, read on every collection.
+func (t *Telemetry) AddQueue(name string, depth func() int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.queues[name] = depth
+}